@@ -0,0 +1,123 @@
+package gometh
+
+import (
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"strings"
+
+	cfg "github.com/adriamb/gometh-server/gometh/config"
+
+	"github.com/ethereum/go-ethereum/accounts"
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/crypto"
+)
+
+func newAccount() error {
+
+	passwd, err := keystorePasswd()
+	if err != nil {
+		return err
+	}
+
+	account, err := openKeystore().NewAccount(passwd)
+	if err != nil {
+		return err
+	}
+
+	fmt.Println("Created account", account.Address.Hex(), "in", account.URL.Path)
+	return nil
+}
+
+// importAccount imports a key file, either a keystore json file or an hex
+// private key, encrypted with the keystore password. A keystore json file is
+// decrypted with the password of source, prompted if source is not set.
+func importAccount(path string, source cfg.PasswdConfig) error {
+
+	content, err := ioutil.ReadFile(path)
+	if err != nil {
+		return err
+	}
+
+	passwd, err := keystorePasswd()
+	if err != nil {
+		return err
+	}
+
+	var account accounts.Account
+	if json.Valid(content) {
+		if !source.IsSet() {
+			source.PasswdPrompt = true
+		}
+		var filePasswd string
+		if filePasswd, err = readPasswdSource("key file", &source); err != nil {
+			return err
+		}
+		account, err = openKeystore().Import(content, filePasswd, passwd)
+	} else {
+		key, keyerr := crypto.HexToECDSA(strings.TrimPrefix(strings.TrimSpace(string(content)), "0x"))
+		if keyerr != nil {
+			return fmt.Errorf("Bad key file %v: %v", path, keyerr)
+		}
+		account, err = openKeystore().ImportECDSA(key, passwd)
+	}
+	if err != nil {
+		return err
+	}
+
+	fmt.Println("Imported account", account.Address.Hex(), "in", account.URL.Path)
+	return nil
+}
+
+func listAccounts() error {
+
+	for i, account := range openKeystore().Accounts() {
+		fmt.Printf("#%v %v %v\n", i, account.Address.Hex(), account.URL.Path)
+	}
+	return nil
+}
+
+// exportAddress prints the address of the configured signer, to be added to
+// the validators, the keystores and keyfiles are not unlocked unless the
+// keyfile has no address
+func exportAddress() error {
+
+	var address common.Address
+
+	switch cfg.C.Signer.Type {
+	case "", "keystore":
+		account, err := selectAccount(openKeystore(), cfg.C.Signer.Address)
+		if err != nil {
+			return err
+		}
+		address = account.Address
+
+	case "keyfile":
+		content, err := ioutil.ReadFile(cfg.C.Signer.KeyFile)
+		if err != nil {
+			return err
+		}
+		var keyfile struct {
+			Address string `json:"address"`
+		}
+		if err := json.Unmarshal(content, &keyfile); err != nil {
+			return err
+		}
+		if common.IsHexAddress(keyfile.Address) {
+			address = common.HexToAddress(keyfile.Address)
+		}
+	}
+
+	// the other signers give their address, and the keyfiles without address
+	// are decrypted to derive it
+	if address == (common.Address{}) {
+		signer, err := newSigner(&cfg.C.Signer)
+		if err != nil {
+			return err
+		}
+		address = signer.Account().Address
+	}
+
+	fmt.Println(address.Hex())
+	return nil
+}
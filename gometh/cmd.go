@@ -1,11 +1,14 @@
 package gometh
 
 import (
+	"context"
 	"encoding/json"
 	"fmt"
 	"log"
 	"math/big"
 	"os"
+	"os/signal"
+	"syscall"
 
 	cfg "github.com/adriamb/gometh-server/gometh/config"
 	"github.com/spf13/cobra"
@@ -29,11 +32,14 @@ var startCmd = &cobra.Command{
 	Short: "Start the server",
 	Long:  "Start the server",
 	Run: func(cmd *cobra.Command, args []string) {
-		json, _ := json.MarshalIndent(cfg.C, "", "  ")
+		json, _ := json.MarshalIndent(cfg.C.Redacted(), "", "  ")
 		log.Println("Efective configuration: " + string(json))
-		initClient()
-		setContractsAddress()
-		serverStart()
+		ctx, stop := signalContext()
+		defer stop()
+		initClient(ctx)
+		setContractsAddress(ctx)
+		initStore(ctx)
+		serverStart(ctx)
 	},
 }
 
@@ -42,9 +48,11 @@ var lockCmd = &cobra.Command{
 	Short: "Lock ethers",
 	Long:  "Send ethers to the parentchain->sidechain",
 	Run: func(cmd *cobra.Command, args []string) {
-		initClient()
-		setContractsAddress()
-		assert(callLock(big.NewInt(10)))
+		ctx, stop := signalContext()
+		defer stop()
+		initClient(ctx)
+		setContractsAddress(ctx)
+		assert(callLock(ctx, big.NewInt(10)))
 	},
 }
 
@@ -53,9 +61,52 @@ var burnCmd = &cobra.Command{
 	Short: "Unlock ethers",
 	Long:  "Send ethers to the sidechain->parentchain",
 	Run: func(cmd *cobra.Command, args []string) {
-		initClient()
-		setContractsAddress()
-		assert(callBurn(big.NewInt(10)))
+		ctx, stop := signalContext()
+		defer stop()
+		initClient(ctx)
+		setContractsAddress(ctx)
+		assert(callBurn(ctx, big.NewInt(10), burnVoucher))
+	},
+}
+
+var burnVoucher string
+
+var redeemVoucher string
+
+var redeemCmd = &cobra.Command{
+	Use:   "redeem [txid]",
+	Short: "Redeem a burn",
+	Long:  "Submit the signatures of a burn in the sidechain to release the ethers in the parentchain",
+	Args:  cobra.MaximumNArgs(1),
+	Run: func(cmd *cobra.Command, args []string) {
+		if (len(args) == 1) == (redeemVoucher != "") {
+			assert(fmt.Errorf("Set either the txid or the --voucher file"))
+		}
+		txid := ""
+		if len(args) == 1 {
+			txid = args[0]
+		}
+		ctx, stop := signalContext()
+		defer stop()
+		initClient(ctx)
+		setContractsAddress(ctx)
+		assert(callRedeem(ctx, txid, redeemVoucher))
+	},
+}
+
+var voucherCmd = &cobra.Command{
+	Use:   "voucher",
+	Short: "Manage burn vouchers",
+	Long:  "Check the vouchers that prove a burn in the sidechain",
+}
+
+var voucherVerifyCmd = &cobra.Command{
+	Use:   "verify <file>",
+	Short: "Verify a voucher",
+	Long:  "Check offline that the signatures of a voucher are from the configured signers",
+	Args:  cobra.ExactArgs(1),
+	Run: func(cmd *cobra.Command, args []string) {
+		assert(verifyVoucher(args[0]))
 	},
 }
 
@@ -64,13 +115,143 @@ var deployCmd = &cobra.Command{
 	Short: "Deploy the smartcontracts",
 	Long:  "Deploy the smartcontracts in two chains",
 	Run: func(cmd *cobra.Command, args []string) {
-		json, _ := json.MarshalIndent(cfg.C, "", "  ")
+		json, _ := json.MarshalIndent(cfg.C.Redacted(), "", "  ")
 		log.Println("Efective configuration: " + string(json))
-		initClient()
-		deployContracts()
+		ctx, stop := signalContext()
+		defer stop()
+		initClient(ctx)
+		deployContracts(ctx)
+	},
+}
+
+var deadLetterCmd = &cobra.Command{
+	Use:   "deadletter",
+	Short: "Manage failed events",
+	Long:  "List, inspect, retry or discard the events whose handler failed",
+}
+
+var deadLetterListCmd = &cobra.Command{
+	Use:   "list",
+	Short: "List failed events",
+	Long:  "List the events whose handler failed",
+	Run: func(cmd *cobra.Command, args []string) {
+		assert(listDeadLetters())
+	},
+}
+
+var deadLetterShowCmd = &cobra.Command{
+	Use:   "show <id>",
+	Short: "Show a failed event",
+	Long:  "Show the details of a failed event",
+	Args:  cobra.ExactArgs(1),
+	Run: func(cmd *cobra.Command, args []string) {
+		assert(showDeadLetter(args[0]))
+	},
+}
+
+var deadLetterRetryCmd = &cobra.Command{
+	Use:   "retry <id>",
+	Short: "Retry a failed event",
+	Long:  "Schedule a failed event to be retried now by the server",
+	Args:  cobra.ExactArgs(1),
+	Run: func(cmd *cobra.Command, args []string) {
+		assert(retryDeadLetter(args[0]))
+	},
+}
+
+var deadLetterDiscardCmd = &cobra.Command{
+	Use:   "discard <id>",
+	Short: "Discard a failed event",
+	Long:  "Remove a failed event, it will not be retried",
+	Args:  cobra.ExactArgs(1),
+	Run: func(cmd *cobra.Command, args []string) {
+		assert(discardDeadLetter(args[0]))
 	},
 }
 
+var txCmd = &cobra.Command{
+	Use:   "tx",
+	Short: "Manage pending transactions",
+	Long:  "Replace the transactions sent by the account that are stuck in the mempool",
+}
+
+var txSpeedUpCmd = &cobra.Command{
+	Use:   "speedup <hash>",
+	Short: "Speed up a pending transaction",
+	Long:  "Send again a pending transaction with the same nonce and higher fees",
+	Args:  cobra.ExactArgs(1),
+	Run: func(cmd *cobra.Command, args []string) {
+		ctx, stop := signalContext()
+		defer stop()
+		initClient(ctx)
+		assert(replaceTransaction(ctx, args[0], false))
+	},
+}
+
+var txCancelCmd = &cobra.Command{
+	Use:   "cancel <hash>",
+	Short: "Cancel a pending transaction",
+	Long:  "Replace a pending transaction by an empty one with the same nonce and higher fees",
+	Args:  cobra.ExactArgs(1),
+	Run: func(cmd *cobra.Command, args []string) {
+		ctx, stop := signalContext()
+		defer stop()
+		initClient(ctx)
+		assert(replaceTransaction(ctx, args[0], true))
+	},
+}
+
+var accountCmd = &cobra.Command{
+	Use:   "account",
+	Short: "Manage accounts",
+	Long:  "Create, import and list the accounts of the keystore",
+}
+
+var accountNewCmd = &cobra.Command{
+	Use:   "new",
+	Short: "Create an account",
+	Long:  "Create a new account in the keystore, encrypted with the keystore password",
+	Run: func(cmd *cobra.Command, args []string) {
+		assert(newAccount())
+	},
+}
+
+// importPasswd is the password source of the imported keystore json file
+var importPasswd cfg.PasswdConfig
+
+var accountImportCmd = &cobra.Command{
+	Use:   "import <keyfile>",
+	Short: "Import an account",
+	Long:  "Import a keystore json file or an hex private key file into the keystore",
+	Args:  cobra.ExactArgs(1),
+	Run: func(cmd *cobra.Command, args []string) {
+		assert(importAccount(args[0], importPasswd))
+	},
+}
+
+var accountListCmd = &cobra.Command{
+	Use:   "list",
+	Short: "List the accounts",
+	Long:  "List the accounts of the keystore",
+	Run: func(cmd *cobra.Command, args []string) {
+		assert(listAccounts())
+	},
+}
+
+var accountExportAddressCmd = &cobra.Command{
+	Use:   "export-address",
+	Short: "Print the signer address",
+	Long:  "Print the address of the configured bridge signer",
+	Run: func(cmd *cobra.Command, args []string) {
+		assert(exportAddress())
+	},
+}
+
+// signalContext returns a context cancelled on SIGINT or SIGTERM
+func signalContext() (context.Context, context.CancelFunc) {
+	return signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+}
+
 // ExecuteCmd adds all child commands to the root command sets flags appropriately.
 // This is called by main.main(). It only needs to happen once to the rootCmd.
 func ExecuteCmd() {
@@ -90,6 +271,27 @@ func init() {
 	RootCmd.AddCommand(deployCmd)
 	RootCmd.AddCommand(lockCmd)
 	RootCmd.AddCommand(burnCmd)
+	burnCmd.Flags().StringVar(&burnVoucher, "voucher", "", "file where the voucher is written, stdout by default")
+	RootCmd.AddCommand(redeemCmd)
+	redeemCmd.Flags().StringVar(&redeemVoucher, "voucher", "", "voucher json file to redeem")
+	RootCmd.AddCommand(voucherCmd)
+	voucherCmd.AddCommand(voucherVerifyCmd)
+	RootCmd.AddCommand(deadLetterCmd)
+	deadLetterCmd.AddCommand(deadLetterListCmd)
+	deadLetterCmd.AddCommand(deadLetterShowCmd)
+	deadLetterCmd.AddCommand(deadLetterRetryCmd)
+	deadLetterCmd.AddCommand(deadLetterDiscardCmd)
+	RootCmd.AddCommand(accountCmd)
+	accountCmd.AddCommand(accountNewCmd)
+	accountCmd.AddCommand(accountImportCmd)
+	accountImportCmd.Flags().StringVar(&importPasswd.PasswdFile, "passwd-file", "", "file with the password of the keystore json file")
+	accountImportCmd.Flags().StringVar(&importPasswd.PasswdEnv, "passwd-env", "", "environment variable with the password of the keystore json file")
+	accountImportCmd.Flags().StringVar(&importPasswd.PasswdCommand, "passwd-command", "", "command that prints the password of the keystore json file")
+	accountCmd.AddCommand(accountListCmd)
+	accountCmd.AddCommand(accountExportAddressCmd)
+	RootCmd.AddCommand(txCmd)
+	txCmd.AddCommand(txSpeedUpCmd)
+	txCmd.AddCommand(txCancelCmd)
 }
 
 // initConfig reads in config file and ENV variables if set.
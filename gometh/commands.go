@@ -1,8 +1,8 @@
 package gometh
 
 import (
+	"context"
 	"encoding/hex"
-	"fmt"
 	"log"
 	"math/big"
 
@@ -11,73 +11,76 @@ import (
 	"github.com/ethereum/go-ethereum/crypto"
 )
 
-func callLock(value *big.Int) error {
-	_, _, err := mainContract.SendTransactionSync(value, 0, "lock")
+func callLock(ctx context.Context, value *big.Int) error {
+	_, _, err := mainContract.SendTransactionSync(ctx, value, 0, "lock")
 
 	return err
 }
 
-func callBurn(value *big.Int) error {
+// callBurn burns value in the side chain and writes the voucher once it is
+// multisigned, to voucherFile or stdout if empty
+func callBurn(ctx context.Context, value *big.Int, voucherFile string) error {
 
 	var txid [32]byte
-	terminate := make(chan bool)
+	eventsctx, terminate := context.WithCancel(ctx)
+	defer terminate()
 	terminated := make(chan bool)
+	multisigned := make(chan types.Log, 16)
 
-	assert(sideClient.RegisterEventHandler(sideContract, "LogBurnMultisigned", func(eventlog *types.Log) error {
+	// events are processed in the event loop, so just forward them
+	assert(sideClient.RegisterEventHandler(sideContract, "LogBurnMultisigned", func(ctx context.Context, eventlog *types.Log) error {
 		log.Printf("RECV callBurn_LogBurnMultisigned")
-
-		type LogBurnMultisigned struct {
-			Txid  [32]byte
-			From  common.Address
-			Value *big.Int
-		}
-
-		var event LogBurnMultisigned
-		err := sideContract.Abi.Unpack(&event, "LogBurnMultisigned", eventlog.Data)
-		if err != nil {
-			return err
-		}
-
-		type GetSignatures struct {
-			Epoch *big.Int
-			Data  []byte
-			Sigs  [][32]byte
-		}
-
-		var output GetSignatures
-		if sideContract.Call(&output, "getSignatures", txid) != nil {
-			return err
-		}
-
-		log.Println("GOT VOUCHER")
-		log.Println("	---------------------------------------- ")
-		log.Println("	TO    : ", event.From.Hex())
-		log.Println("	VALUE : ", event.Value)
-		log.Println("	---------------------------------------- ")
-		log.Println("	EPOCH : ", output.Epoch)
-		log.Println("	DATA  : ", hex.EncodeToString(output.Data))
-		for _, v := range output.Sigs {
-			log.Println("	SIG  : ", hex.EncodeToString(v[:]))
+		// the event loop is stopped when callBurn returns
+		select {
+		case multisigned <- *eventlog:
+			return nil
+		case <-ctx.Done():
+			return ctx.Err()
 		}
-
-		terminate <- true
-
-		return nil
 	}))
-	sideClient.HandleEvents(terminate, terminated)
+	if err := sideClient.HandleEvents(eventsctx, terminated); err != nil {
+		return err
+	}
 
-	tx, _, err := sideContract.SendTransactionSync(big.NewInt(0), 0, "burn", value)
+	tx, _, err := sideContract.SendTransactionSync(ctx, big.NewInt(0), 0, "burn", value)
 	if err != nil {
 		return err
 	}
 
-	topicID := sideContract.Abi.Events["LogBurn"].Id()
+	topicID := sideContract.Abi.Events["LogBurn"].ID
 
 	copy(txid[:], crypto.Keccak256(tx.Hash().Bytes(), topicID.Bytes()))
 
-	fmt.Println("Burn called, receipt id=", hex.EncodeToString(txid[:]))
+	log.Println("Burn called, receipt id=", hex.EncodeToString(txid[:]))
+
+	type LogBurnMultisigned struct {
+		Txid  [32]byte
+		From  common.Address
+		Value *big.Int
+	}
+
+	var event LogBurnMultisigned
+	for event.Txid != txid {
+		select {
+		case eventlog := <-multisigned:
+			if err := sideContract.DecodeEvent(&event, "LogBurnMultisigned", &eventlog); err != nil {
+				return err
+			}
+		case <-ctx.Done():
+			return ctx.Err()
+		}
+	}
 
+	terminate()
 	<-terminated
 
-	return err
+	voucher, err := fetchVoucher(ctx, txid)
+	if err != nil {
+		return err
+	}
+
+	log.Println("GOT VOUCHER", hex.EncodeToString(txid[:]), event.Value, "wei to", event.From.Hex())
+	log.Println("Redeem it in the main chain with: gometh redeem", hex.EncodeToString(txid[:]))
+
+	return writeVoucher(voucher, voucherFile)
 }
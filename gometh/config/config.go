@@ -2,6 +2,7 @@ package gometh
 
 import (
 	"fmt"
+	"net/url"
 
 	"github.com/ethereum/go-ethereum/common"
 )
@@ -13,25 +14,221 @@ var C Config
 
 // Config is the server configurtion
 type Config struct {
+	DataDir string
+
+	// MetricsAddr, if set, is the address where metrics are served
+	MetricsAddr string
+
 	Keystore struct {
-		Path   string
-		Passwd string
+		Path string
+		// the password of the keystore accounts
+		PasswdConfig `mapstructure:",squash"`
 	}
 
+	// Signer produces the bridge signatures, and sends the transactions of
+	// the chains without a Sender
+	Signer SignerConfig
+
 	Contracts struct {
 		Path          string
 		DeploySigners []string
 	}
 
-	MainChain struct {
-		RPCURL        string
-		BridgeAddress string
+	// Tokens are the ERC20 tokens bridged besides ether
+	Tokens []TokenConfig
+
+	MainChain ChainConfig
+	SideChain ChainConfig
+
+	Relayer RelayerConfig
+
+	DeadLetters struct {
+		// MaxAttempts is the max number of times a failed event is handled
+		MaxAttempts int
+		// MinBackoff and MaxBackoff, in seconds, bound the wait between retries
+		MinBackoff uint64
+		MaxBackoff uint64
 	}
+}
+
+// SignerConfig selects the key of an account
+type SignerConfig struct {
+	// Type is keystore, keyfile or external, keystore by default
+	Type string
+	// KeyFile is the encrypted key file of the keyfile signer
+	KeyFile string
+	// the password unlocks the account, the one of Keystore by default
+	PasswdConfig `mapstructure:",squash"`
+	// Endpoint is the url or ipc path of the external signer
+	Endpoint string
+	// Address is the account of the keystore or the external signer, needed
+	// if they have more than one
+	Address string
+}
+
+// PasswdConfig is where a password is read from, only one source should
+// be set
+type PasswdConfig struct {
+	// Passwd is the password in plaintext, use one of the other sources
+	Passwd string
+	// PasswdFile is a file with the password, it must be readable only by
+	// its owner
+	PasswdFile string
+	// PasswdEnv is the environment variable with the password
+	PasswdEnv string
+	// PasswdCommand is a shell command whose output is the password
+	PasswdCommand string
+	// PasswdPrompt asks for the password in the terminal
+	PasswdPrompt bool
+}
+
+// IsSet returns true if a password source is set
+func (p *PasswdConfig) IsSet() bool {
+	return *p != PasswdConfig{}
+}
+
+// TokenConfig maps an ERC20 token of the main chain to its wrapped token in
+// the side chain
+type TokenConfig struct {
+	// Name identifies the token in the logs
+	Name string
+	// MainAddress is the ERC20 token in the main chain
+	MainAddress string
+	// SideAddress is the wrapped token in the side chain, deploy creates it
+	// if empty
+	SideAddress string
+}
+
+// RelayerConfig sets the relay of the multisigned burns to the main chain,
+// on behalf of the users
+type RelayerConfig struct {
+	Enabled bool
+	// MinValue, in ether, is the min value of the ether burns relayed, the
+	// token burns are always relayed
+	MinValue float64
+	// MaxFee, in gwei, is the max gas price, or fee cap, paid to relay, the
+	// relay waits while the fees are higher, 0 means no max
+	MaxFee float64
+	// Delay, in seconds, is what each validator waits after the previous
+	// one before relaying, so usually only the first one sends it
+	Delay uint64
+	// RedeemedMethod is the constant method of the main contract that
+	// returns if a burn txid was redeemed, checked before relaying it,
+	// "redeemed" by default
+	RedeemedMethod string
+	// RedeemedReason is the revert reason of the main contract for a burn
+	// already redeemed, used if the contract has no RedeemedMethod,
+	// "already redeemed" by default
+	RedeemedReason string
+}
+
+// ChainConfig is the configuration of one of the bridged chains
+type ChainConfig struct {
+	RPCURL        string
+	BridgeAddress string
+
+	// Sender, if set, is the account that sends and pays the transactions
+	// of the chain instead of the Signer. The votes sent with
+	// partialExecuteOn are from the sender, so it must be a validator.
+	Sender SignerConfig
+
+	// StartBlock is where event processing starts if there is no checkpoint
+	StartBlock uint64
+	// BlockWindow is the max number of blocks requested per call while
+	// catching up past events, 0 means the default
+	BlockWindow uint64
+	// Confirmations is the number of blocks an event must be deep to be
+	// processed, events removed by a reorg before that are cancelled
+	Confirmations uint64
+	// PollInterval, in seconds, enables polling the node for new events
+	// instead of subscribing, used for nodes without websockets
+	PollInterval uint64
+	// EventWorkers is the max number of transactions of the same block whose
+	// events are handled concurrently, by default they are sequential
+	EventWorkers int
+	// ReceiptTimeout, in seconds, is how long a transaction waits for its
+	// receipt since it was last sent before it is dropped, while it is
+	// being replaced it is not dropped, 0 means the default of 120
+	ReceiptTimeout uint64
+
+	Gas GasConfig
+}
+
+// GasConfig sets how the fees of the transactions sent to a chain are
+// computed, fees are in gwei
+type GasConfig struct {
+	// Strategy is fixed, oracle, percentile or zero, oracle by default
+	Strategy string
+	// TxType is auto, legacy or dynamic, auto by default
+	TxType string
+
+	// Price, FeeCap and TipCap are the fees of the fixed strategy
+	Price  float64
+	FeeCap float64
+	TipCap float64
+
+	// Blocks and Percentile are used by the percentile strategy
+	Blocks     int
+	Percentile float64
 
-	SideChain struct {
-		RPCURL        string
-		BridgeAddress string
+	// MaxPrice, MaxFeeCap and MaxTipCap cap the fees, 0 means no cap
+	MaxPrice  float64
+	MaxFeeCap float64
+	MaxTipCap float64
+
+	// ReplaceAfter, in seconds, is the time a transaction is pending before
+	// it is replaced with higher fees, 0 disables the replacements
+	ReplaceAfter uint64
+	// ReplaceBump is the percent the fees are increased by each replacement
+	ReplaceBump int64
+	// ReplaceMaxFee is the max gas price, or fee cap, of a replacement
+	ReplaceMaxFee float64
+}
+
+const redacted = "REDACTED"
+
+func (p *PasswdConfig) redact() {
+	if p.Passwd != "" {
+		p.Passwd = redacted
+	}
+	// the command may have the password or a token in its arguments
+	if p.PasswdCommand != "" {
+		p.PasswdCommand = redacted
+	}
+}
+
+func (c *SignerConfig) redact() {
+	c.PasswdConfig.redact()
+	c.Endpoint = redactURL(c.Endpoint)
+}
+
+// redactURL removes the credentials of an url, in the user info or in the
+// query, like the api keys of node providers
+func redactURL(rawurl string) string {
+	u, err := url.Parse(rawurl)
+	if err != nil || (u.User == nil && u.RawQuery == "") {
+		return rawurl
+	}
+	if u.User != nil {
+		u.User = url.User(redacted)
+	}
+	if u.RawQuery != "" {
+		u.RawQuery = redacted
 	}
+	return u.String()
+}
+
+// Redacted returns a copy of the configuration without the secrets, to be
+// logged
+func (c *Config) Redacted() Config {
+	r := *c
+	r.Keystore.redact()
+	r.Signer.redact()
+	for _, chain := range []*ChainConfig{&r.MainChain, &r.SideChain} {
+		chain.Sender.redact()
+		chain.RPCURL = redactURL(chain.RPCURL)
+	}
+	return r
 }
 
 func (c *Config) VerifyDeploySigners() error {
@@ -46,6 +243,26 @@ func (c *Config) VerifyDeploySigners() error {
 	return nil
 }
 
+func (c *Config) VerifyTokens() error {
+
+	seen := make(map[string]bool)
+	for _, token := range c.Tokens {
+		if !common.IsHexAddress(token.MainAddress) {
+			return fmt.Errorf("Bad MainAddress %v of token %v", token.MainAddress, token.Name)
+		}
+		if token.SideAddress != "" && !common.IsHexAddress(token.SideAddress) {
+			return fmt.Errorf("Bad SideAddress %v of token %v", token.SideAddress, token.Name)
+		}
+		main := common.HexToAddress(token.MainAddress).Hex()
+		if seen[main] {
+			return fmt.Errorf("Token %v is configured twice", token.MainAddress)
+		}
+		seen[main] = true
+	}
+
+	return nil
+}
+
 func (c *Config) VerifyAddresses() error {
 
 	if !common.IsHexAddress(c.MainChain.BridgeAddress) {
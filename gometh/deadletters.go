@@ -0,0 +1,88 @@
+package gometh
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"text/tabwriter"
+	"time"
+
+	"github.com/adriamb/gometh-server/gometh/store"
+)
+
+func listDeadLetters() error {
+
+	deadletters, err := openDeadLetters().List()
+	if err != nil {
+		return err
+	}
+
+	w := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+	fmt.Fprintln(w, "ID\tEVENT\tATTEMPTS\tRETRY\tERROR")
+	for _, d := range deadletters {
+		retry := "no"
+		if d.Retryable {
+			retry = d.NextAttempt.Format(time.RFC3339)
+		}
+		fmt.Fprintf(w, "%v\t%v\t%v\t%v\t%v\n", d.ID, d.Event, d.Attempts, retry, d.Error)
+	}
+	return w.Flush()
+}
+
+func showDeadLetter(id string) error {
+
+	deadletter, err := openDeadLetters().Get(id)
+	if err == store.ErrNotFound {
+		return fmt.Errorf("Dead letter %v not found", id)
+	}
+	if err != nil {
+		return err
+	}
+
+	json, err := json.MarshalIndent(deadletter, "", "  ")
+	if err != nil {
+		return err
+	}
+	fmt.Println(string(json))
+	return nil
+}
+
+func retryDeadLetter(id string) error {
+
+	deadletters := openDeadLetters()
+
+	deadletter, err := deadletters.Get(id)
+	if err == store.ErrNotFound {
+		return fmt.Errorf("Dead letter %v not found", id)
+	}
+	if err != nil {
+		return err
+	}
+
+	deadletter.Retryable = true
+	deadletter.NextAttempt = time.Now()
+	if err := deadletters.Put(deadletter); err != nil {
+		return err
+	}
+
+	fmt.Println("Dead letter", id, "will be retried by the server")
+	return nil
+}
+
+func discardDeadLetter(id string) error {
+
+	deadletters := openDeadLetters()
+
+	if _, err := deadletters.Get(id); err == store.ErrNotFound {
+		return fmt.Errorf("Dead letter %v not found", id)
+	} else if err != nil {
+		return err
+	}
+
+	if err := deadletters.Delete(id); err != nil {
+		return err
+	}
+
+	fmt.Println("Dead letter", id, "discarded")
+	return nil
+}
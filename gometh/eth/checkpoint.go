@@ -0,0 +1,67 @@
+package eth
+
+import (
+	"fmt"
+	"math/big"
+	"strings"
+
+	"github.com/adriamb/gometh-server/gometh/store"
+
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/core/types"
+)
+
+// Checkpoint is the position of the last fully processed log in a chain
+type Checkpoint struct {
+	Block uint64
+	Index uint
+}
+
+// IsProcessed returns true if the log is at or before the checkpoint
+func (c *Checkpoint) IsProcessed(eventlog *types.Log) bool {
+	if c == nil {
+		return false
+	}
+	if eventlog.BlockNumber != c.Block {
+		return eventlog.BlockNumber < c.Block
+	}
+	return eventlog.Index <= c.Index
+}
+
+// checkpointID identifies the checkpoint of the events of a contract, so
+// the checkpoint of another chain or deployment is not resumed
+func checkpointID(chain string, chainID *big.Int, contract common.Address) string {
+	return fmt.Sprintf("%v-%v-%v", chain, chainID, strings.ToLower(contract.Hex()))
+}
+
+// CheckpointStore persists the checkpoint of each chain
+type CheckpointStore struct {
+	store *store.Store
+}
+
+// NewCheckpointStore creates a checkpoint store on top of a store
+func NewCheckpointStore(s *store.Store) (*CheckpointStore, error) {
+	bucket, err := s.Bucket("checkpoints")
+	if err != nil {
+		return nil, err
+	}
+	return &CheckpointStore{bucket}, nil
+}
+
+// Load returns the checkpoint with the id, or nil if nothing was processed yet
+func (c *CheckpointStore) Load(id string) (*Checkpoint, error) {
+	var checkpoint Checkpoint
+	err := c.store.Get(id, &checkpoint)
+	if err == store.ErrNotFound {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	return &checkpoint, nil
+}
+
+// Save stores the checkpoint with the id
+func (c *CheckpointStore) Save(id string, checkpoint Checkpoint) error {
+	return c.store.Put(id, &checkpoint)
+}
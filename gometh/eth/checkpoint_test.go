@@ -0,0 +1,74 @@
+package eth
+
+import (
+	"math/big"
+	"testing"
+
+	"github.com/adriamb/gometh-server/gometh/store"
+
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/core/types"
+)
+
+func TestCheckpointIsProcessed(t *testing.T) {
+
+	checkpoint := &Checkpoint{Block: 10, Index: 3}
+	rewound := &Checkpoint{Block: 9, Index: ^uint(0)}
+
+	tests := []struct {
+		checkpoint *Checkpoint
+		block      uint64
+		index      uint
+		processed  bool
+	}{
+		{nil, 0, 0, false},
+		{checkpoint, 9, 100, true},
+		{checkpoint, 10, 2, true},
+		{checkpoint, 10, 3, true},
+		{checkpoint, 10, 4, false},
+		{checkpoint, 11, 0, false},
+		{rewound, 9, 100, true},
+		{rewound, 10, 0, false},
+	}
+
+	for _, test := range tests {
+		eventlog := &types.Log{BlockNumber: test.block, Index: test.index}
+		if got := test.checkpoint.IsProcessed(eventlog); got != test.processed {
+			t.Errorf("%+v IsProcessed(%v, %v) = %v", test.checkpoint, test.block, test.index, got)
+		}
+	}
+}
+
+func TestCheckpointStore(t *testing.T) {
+
+	datastore, err := store.Open(t.TempDir())
+	if err != nil {
+		t.Fatal(err)
+	}
+	checkpoints, err := NewCheckpointStore(datastore)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	bridge := common.HexToAddress("0x1111111111111111111111111111111111111111")
+	id := checkpointID("main", big.NewInt(1), bridge)
+	if err := checkpoints.Save(id, Checkpoint{Block: 10, Index: 3}); err != nil {
+		t.Fatal(err)
+	}
+
+	loaded, err := checkpoints.Load(id)
+	if err != nil || loaded == nil || *loaded != (Checkpoint{Block: 10, Index: 3}) {
+		t.Errorf("loaded %v, %v", loaded, err)
+	}
+
+	// another chain or deployment of the bridge starts without checkpoint
+	others := []string{
+		checkpointID("main", big.NewInt(5), bridge),
+		checkpointID("main", big.NewInt(1), common.HexToAddress("0x2222222222222222222222222222222222222222")),
+	}
+	for _, other := range others {
+		if loaded, err := checkpoints.Load(other); err != nil || loaded != nil {
+			t.Errorf("%v loaded %v, %v", other, loaded, err)
+		}
+	}
+}
@@ -10,10 +10,9 @@ import (
 	"log"
 	"math/big"
 
-	cfg "github.com/adriamb/gometh-server/gometh/config"
-
 	"github.com/ethereum/go-ethereum/accounts/abi"
 	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/common/math"
 	"github.com/ethereum/go-ethereum/core/types"
 	"github.com/ethereum/go-ethereum/crypto"
 )
@@ -24,6 +23,13 @@ type Contract struct {
 	Client   *Web3Client
 	ByteCode []byte
 	Address  *common.Address
+
+	// Signings, if set, records the partial executions sent to the contract
+	Signings *SigningJournal
+
+	// BridgeSigner, if set, produces the bridge signatures instead of the
+	// account that sends the transactions
+	BridgeSigner Signer
 }
 
 var (
@@ -67,8 +73,8 @@ func NewContract(client *Web3Client, jsonFile string) (*Contract, error) {
 }
 
 // SetAddress sets the contract's address
-func (b *Contract) SetAddress(address common.Address) error {
-	code, err := b.Client.Client.CodeAt(context.TODO(), address, nil)
+func (b *Contract) SetAddress(ctx context.Context, address common.Address) error {
+	code, err := b.Client.conn().CodeAt(ctx, address, nil)
 	if err != nil {
 		return err
 	}
@@ -80,26 +86,87 @@ func (b *Contract) SetAddress(address common.Address) error {
 	return nil
 }
 
-// SendTransactionSync executes a contract method and wait it finalizes
-func (b *Contract) SendTransactionSync(value *big.Int, gasLimit uint64, funcname string, params ...interface{}) (*types.Transaction, *types.Receipt, error) {
+// SendTransaction executes a contract method without waiting for it, the
+// call is simulated first and rejected with a RevertError if it would fail
+func (b *Contract) SendTransaction(ctx context.Context, value *big.Int, gasLimit uint64, funcname string, params ...interface{}) (*PendingTx, error) {
+	return b.sendIntent(ctx, funcname, value, gasLimit, funcname, params...)
+}
+
+// sendIntent executes a contract method, intent describes it in the journal
+func (b *Contract) sendIntent(ctx context.Context, intent string, value *big.Int, gasLimit uint64, funcname string, params ...interface{}) (*PendingTx, error) {
 
 	msg, err := b.Abi.Pack(funcname, params...)
 	if err != nil {
-		if cfg.Verbose > 0 {
-			log.Println("Failed packing ", funcname)
+		return nil, err
+	}
+	if err := b.simulate(ctx, funcname, value, gasLimit, msg); err != nil {
+		log.Println("[TxRejected]", err)
+		return nil, err
+	}
+	pending, err := b.Client.sendIntent(ctx, intent, b.Address, value, gasLimit, msg)
+	if err != nil {
+		log.Println("Failed calling ", funcname)
+	}
+
+	return pending, err
+}
+
+// SendTransactionSync executes a contract method and wait it finalizes, if
+// it fails the error is a RevertError with the reason
+func (b *Contract) SendTransactionSync(ctx context.Context, value *big.Int, gasLimit uint64, funcname string, params ...interface{}) (*types.Transaction, *types.Receipt, error) {
+
+	pending, err := b.SendTransaction(ctx, value, gasLimit, funcname, params...)
+	if err != nil {
+		return nil, nil, err
+	}
+	return b.wait(ctx, funcname, pending)
+}
+
+// SendIntentSync executes a contract method once per intent, a transaction
+// of the intent in the journal is resumed, or returned if mined, instead of
+// sent again
+func (b *Contract) SendIntentSync(ctx context.Context, intent string, value *big.Int, gasLimit uint64, funcname string, params ...interface{}) (*types.Transaction, *types.Receipt, error) {
+
+	pending, entry, err := b.Client.Resume(ctx, intent)
+	if err != nil {
+		log.Println("[TxResumeFailed]", intent, err)
+		return nil, nil, err
+	}
+	if entry != nil && entry.Status == JournalMined {
+		hash := common.HexToHash(entry.MinedHash)
+		tx, _, err := b.Client.conn().TransactionByHash(ctx, hash)
+		if err != nil {
 			return nil, nil, err
 		}
+		receipt, err := b.Client.conn().TransactionReceipt(ctx, hash)
+		return tx, receipt, err
+	}
+
+	if pending != nil {
+		log.Println("[TxResumed]", intent, pending.Hash().Hex())
+	} else if pending, err = b.sendIntent(ctx, intent, value, gasLimit, funcname, params...); err != nil {
+		return nil, nil, err
+	}
+	return b.wait(ctx, funcname, pending)
+}
+
+// wait waits for a sent transaction, tracing the reason if it failed
+func (b *Contract) wait(ctx context.Context, funcname string, pending *PendingTx) (*types.Transaction, *types.Receipt, error) {
+
+	receipt, err := pending.Wait(ctx)
+	tx := pending.Transaction()
+	if err == ErrReceiptStatusFailed {
+		err = b.traceFailure(ctx, funcname, tx, receipt)
 	}
-	tx, receipt, err := b.Client.SendTransactionSync(b.Address, value, gasLimit, msg)
 	if err != nil {
-		log.Println("Failed calling ", funcname)
+		log.Println("Failed calling ", funcname, err)
 	}
 
 	return tx, receipt, err
 }
 
 // Deploy the contract
-func (b *Contract) Deploy(params ...interface{}) (*types.Transaction, *types.Receipt, error) {
+func (b *Contract) Deploy(ctx context.Context, params ...interface{}) (*types.Transaction, *types.Receipt, error) {
 
 	init, err := b.Abi.Pack("", params...)
 	if err != nil {
@@ -109,7 +176,7 @@ func (b *Contract) Deploy(params ...interface{}) (*types.Transaction, *types.Rec
 	code := append([]byte(nil), b.ByteCode...)
 	code = append(code, init...)
 
-	tx, receipt, err := b.Client.SendTransactionSync(nil, big.NewInt(0), 0, code)
+	tx, receipt, err := b.Client.SendTransactionSync(ctx, nil, big.NewInt(0), 0, code)
 
 	if err == nil {
 		b.Address = &receipt.ContractAddress
@@ -119,29 +186,35 @@ func (b *Contract) Deploy(params ...interface{}) (*types.Transaction, *types.Rec
 }
 
 // Call an constant method
-func (b *Contract) Call(ret interface{}, funcname string, params ...interface{}) error {
+func (b *Contract) Call(ctx context.Context, ret interface{}, funcname string, params ...interface{}) error {
 
 	input, err := b.Abi.Pack(funcname, params...)
 	if err != nil {
 		return err
 	}
-	output, err := b.Client.Call(b.Address, big.NewInt(0), input)
+	output, err := b.Client.Call(ctx, b.Address, big.NewInt(0), input)
 	if err != nil {
 		return err
 	}
-	return b.Abi.Unpack(ret, funcname, output)
+	return b.Abi.UnpackIntoInterface(ret, funcname, output)
 }
 
-func sign(client *Web3Client, data ...[]byte) ([3][32]byte, error) {
-	web3SignaturePrefix := []byte("\x19Ethereum Signed Message:\n32")
+// bridgeSigner returns the signer of the bridge signatures
+func (b *Contract) bridgeSigner() Signer {
+	if b.BridgeSigner != nil {
+		return b.BridgeSigner
+	}
+	return b.Client.Signer
+}
 
+func sign(signer Signer, data ...[]byte) ([3][32]byte, error) {
 	hash := crypto.Keccak256(data...)
-	prefixedHash := crypto.Keccak256(web3SignaturePrefix, hash)
 
 	var ret [3][32]byte
 
-	// The produced signature is in the [R || S || V] format where V is 0 or 1.
-	sig, err := client.Ks.SignHash(client.Account, prefixedHash)
+	// The produced signature is in the [R || S || V] format where V is 0 or 1,
+	// the signer adds the "\x19Ethereum Signed Message:\n32" prefix
+	sig, err := signer.SignText(hash)
 	if err != nil {
 		return ret, err
 	}
@@ -153,29 +226,110 @@ func sign(client *Web3Client, data ...[]byte) ([3][32]byte, error) {
 	return ret, nil
 }
 
-func (b *Contract) PartialExecuteOff(eventlog *types.Log, value *big.Int, gasLimit uint64, funcname string, params ...interface{}) ([32]byte, error) {
+// TxID returns the bridge transaction id of an event log
+func TxID(eventlog *types.Log) ([32]byte, error) {
+	var txid [32]byte
+	if len(eventlog.Topics) == 0 {
+		return txid, ErrEventTopicCount
+	}
+	copy(txid[:], crypto.Keccak256(eventlog.TxHash.Bytes(), eventlog.Topics[0].Bytes()))
+	return txid, nil
+}
+
+// partialExecute sends the partial execution of txid and records the outcome
+func (b *Contract) partialExecute(ctx context.Context, txid [32]byte, funcname string, gasLimit uint64, method string, params ...interface{}) error {
+
+	// a transaction sent before a restart is resumed instead of sent again
+	intent := method + " " + funcname + " " + hex.EncodeToString(txid[:])
+	pending, entry, err := b.Client.Resume(ctx, intent)
+	if err != nil {
+		log.Println("[TxResumeFailed]", intent, err)
+		return err
+	}
+	if entry != nil && entry.Status == JournalMined {
+		b.recordSigning(txid, funcname, SigningConfirmed, nil, nil)
+		return nil
+	}
+
+	var tx *types.Transaction
+	if pending != nil {
+		log.Println("[TxResumed]", intent, pending.Hash().Hex())
+		tx, _, err = b.wait(ctx, method, pending)
+	} else {
+		b.recordSigning(txid, funcname, SigningPending, nil, nil)
+		if pending, err = b.sendIntent(ctx, intent, big.NewInt(0), gasLimit, method, params...); err == nil {
+			tx, _, err = b.wait(ctx, method, pending)
+		}
+	}
+
+	status := SigningConfirmed
+	if err != nil {
+		status = SigningFailed
+	}
+	b.recordSigning(txid, funcname, status, tx, err)
+
+	return err
+}
+
+// PartialExecuteOn votes, as sender, the execution of funcname for the txid
+// of the event, it is skipped if this validator already voted
+func (b *Contract) PartialExecuteOn(ctx context.Context, eventlog *types.Log, value *big.Int, gasLimit uint64, funcname string, params ...interface{}) ([32]byte, error) {
+
+	txid, err := TxID(eventlog)
+	if err != nil {
+		return txid, err
+	}
+
+	log.Println("TXID ", funcname, " ", hex.EncodeToString(txid[:]))
+
+	if signed, err := b.alreadySigned(ctx, txid, funcname, false); err != nil || signed {
+		if signed {
+			log.Println("[AlreadySigned] ", funcname, " ", hex.EncodeToString(txid[:]))
+		}
+		return txid, err
+	}
+
+	msg, err := b.Abi.Pack(funcname, params...)
+	if err != nil {
+		return txid, err
+	}
+
+	err = b.partialExecute(ctx, txid, funcname, gasLimit, "partialExecuteOn", txid, msg)
+
+	return txid, err
+}
+
+// PartialExecuteOff signs the execution of funcname for the txid of the event,
+// it is skipped if this validator already signed it
+func (b *Contract) PartialExecuteOff(ctx context.Context, eventlog *types.Log, value *big.Int, gasLimit uint64, funcname string, params ...interface{}) ([32]byte, error) {
 
 	epoch := big.NewInt(0)
 
-	txhash := crypto.Keccak256(eventlog.TxHash.Bytes(), eventlog.Topics[0].Bytes())
-	var txid [32]byte
-	copy(txid[:], txhash)
+	txid, err := TxID(eventlog)
+	if err != nil {
+		return txid, err
+	}
 
 	log.Println("TXID ", funcname, " ", hex.EncodeToString(txid[:]))
 
+	if signed, err := b.alreadySigned(ctx, txid, funcname, true); err != nil || signed {
+		if signed {
+			log.Println("[AlreadySigned] ", funcname, " ", hex.EncodeToString(txid[:]))
+		}
+		return txid, err
+	}
+
 	msg, err := b.Abi.Pack(funcname, params...)
 	if err != nil {
 		return txid, err
 	}
 
-	sig, err := sign(b.Client, abi.U256(epoch), txid[:], msg)
+	sig, err := sign(b.bridgeSigner(), math.U256Bytes(epoch), txid[:], msg)
 	if err != nil {
 		return txid, err
 	}
-	_, _, err = b.SendTransactionSync(
-		big.NewInt(0), gasLimit,
-		"partialExecuteOff", txid, msg, sig,
-	)
+
+	err = b.partialExecute(ctx, txid, funcname, gasLimit, "partialExecuteOff", txid, msg, sig)
 
 	return txid, err
 }
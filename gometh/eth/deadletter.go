@@ -0,0 +1,322 @@
+package eth
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"math/big"
+	"time"
+
+	"github.com/adriamb/gometh-server/gometh/store"
+
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/core/types"
+)
+
+// PermanentError marks a handler error that will fail again if retried
+type PermanentError struct {
+	Err error
+}
+
+func (e *PermanentError) Error() string {
+	return e.Err.Error()
+}
+
+// Permanent marks err as not retryable
+func Permanent(err error) error {
+	if err == nil {
+		return nil
+	}
+	return &PermanentError{err}
+}
+
+// IsRetryable returns true if a failed handler may succeed if retried
+func IsRetryable(err error) bool {
+	switch err.(type) {
+	case *PermanentError, *EventDecodeError, *RevertError:
+		return false
+	}
+	return err != ErrReceiptStatusFailed
+}
+
+// RetryPolicy defines how failed events are retried, the wait between
+// attempts doubles from MinBackoff to MaxBackoff
+type RetryPolicy struct {
+	MaxAttempts int
+	MinBackoff  time.Duration
+	MaxBackoff  time.Duration
+}
+
+// DefaultRetryPolicy is the policy used when none is set
+var DefaultRetryPolicy = RetryPolicy{
+	MaxAttempts: 10,
+	MinBackoff:  30 * time.Second,
+	MaxBackoff:  time.Hour,
+}
+
+func (p *RetryPolicy) backoff(attempts int) time.Duration {
+	backoff := p.MinBackoff
+	for i := 1; i < attempts && backoff < p.MaxBackoff; i++ {
+		backoff *= 2
+	}
+	if backoff > p.MaxBackoff {
+		backoff = p.MaxBackoff
+	}
+	return backoff
+}
+
+// DeadLetter is an event whose handler failed, it is only retried while
+// BlockHash is in the canonical chain
+type DeadLetter struct {
+	ID    string
+	Chain string
+	Event string
+	// Handler is the ID of the handler that failed
+	Handler     string
+	BlockHash   common.Hash
+	Log         types.Log
+	Error       string
+	Attempts    int
+	Retryable   bool
+	FirstFailed time.Time
+	LastFailed  time.Time
+	NextAttempt time.Time
+}
+
+// Due returns true if the dead letter has to be retried now
+func (d *DeadLetter) Due(now time.Time) bool {
+	return d.Retryable && !now.Before(d.NextAttempt)
+}
+
+// DeadLetterStore persists the failed events
+type DeadLetterStore struct {
+	store *store.Store
+}
+
+// NewDeadLetterStore creates a dead letter store on top of a store
+func NewDeadLetterStore(s *store.Store) (*DeadLetterStore, error) {
+	bucket, err := s.Bucket("deadletters")
+	if err != nil {
+		return nil, err
+	}
+	return &DeadLetterStore{bucket}, nil
+}
+
+func deadLetterID(chain string, eventlog *types.Log, handler string) string {
+	return fmt.Sprintf("%v-%010d-%05d-%v", chain, eventlog.BlockNumber, eventlog.Index, handler)
+}
+
+// Get returns the dead letter with the id
+func (d *DeadLetterStore) Get(id string) (*DeadLetter, error) {
+	var deadletter DeadLetter
+	if err := d.store.Get(id, &deadletter); err != nil {
+		return nil, err
+	}
+	if deadletter.BlockHash == (common.Hash{}) {
+		deadletter.BlockHash = deadletter.Log.BlockHash
+	}
+	return &deadletter, nil
+}
+
+// Put saves the dead letter
+func (d *DeadLetterStore) Put(deadletter *DeadLetter) error {
+	return d.store.Put(deadletter.ID, deadletter)
+}
+
+// Delete removes the dead letter
+func (d *DeadLetterStore) Delete(id string) error {
+	return d.store.Delete(id)
+}
+
+// List returns all the dead letters, ordered by chain and position
+func (d *DeadLetterStore) List() ([]*DeadLetter, error) {
+	ids, err := d.store.Keys()
+	if err != nil {
+		return nil, err
+	}
+	deadletters := []*DeadLetter{}
+	for _, id := range ids {
+		deadletter, err := d.Get(id)
+		if err != nil {
+			return nil, err
+		}
+		deadletters = append(deadletters, deadletter)
+	}
+	return deadletters, nil
+}
+
+// deadLetter records the failure of a handler
+func (b *Web3Client) deadLetter(handler EventHandler, eventlog *types.Log, err error) {
+
+	if b.DeadLetters == nil {
+		return
+	}
+
+	id := deadLetterID(b.Name, eventlog, handler.ID)
+	now := time.Now()
+
+	// a dead letter of a reorged block at the same position is replaced
+	deadletter, geterr := b.DeadLetters.Get(id)
+	if geterr == store.ErrNotFound || (geterr == nil && deadletter.BlockHash != eventlog.BlockHash) {
+		deadletter = &DeadLetter{
+			ID:          id,
+			Chain:       b.Name,
+			Event:       handler.EventSignature,
+			Handler:     handler.ID,
+			BlockHash:   eventlog.BlockHash,
+			Log:         *eventlog,
+			FirstFailed: now,
+		}
+	} else if geterr != nil {
+		log.Println("[DeadLetterFailed]", id, geterr)
+		return
+	}
+
+	deadletter.Attempts++
+	deadletter.Error = err.Error()
+	deadletter.LastFailed = now
+	deadletter.Retryable = IsRetryable(err) && deadletter.Attempts < b.RetryPolicy.MaxAttempts
+	deadletter.NextAttempt = now.Add(b.RetryPolicy.backoff(deadletter.Attempts))
+
+	if err := b.DeadLetters.Put(deadletter); err != nil {
+		log.Println("[DeadLetterFailed]", id, err)
+		return
+	}
+
+	if deadletter.Retryable {
+		log.Printf("[DeadLetter] %v attempt %v failed, retrying at %v", id, deadletter.Attempts, deadletter.NextAttempt.Format(time.RFC3339))
+	} else {
+		log.Printf("[DeadLetter] %v attempt %v failed, not retrying", id, deadletter.Attempts)
+	}
+}
+
+// eventHandler returns the handler with the id, nil if it is not registered
+func (b *Web3Client) eventHandler(id string) *EventHandler {
+	for i := range b.EventHandlers {
+		if b.EventHandlers[i].ID == id {
+			return &b.EventHandlers[i]
+		}
+	}
+	return nil
+}
+
+// retryDeadLetters runs again the handlers of the due dead letters
+func (b *Web3Client) retryDeadLetters(ctx context.Context) {
+
+	deadletters, err := b.DeadLetters.List()
+	if err != nil {
+		log.Println("[DeadLetterFailed]", err)
+		return
+	}
+
+	now := time.Now()
+	for _, deadletter := range deadletters {
+		if ctx.Err() != nil {
+			return
+		}
+		if deadletter.Chain != b.Name || !deadletter.Due(now) {
+			continue
+		}
+
+		handler := b.eventHandler(deadletter.Handler)
+		if handler == nil || handler.EventSignature != deadletter.Event {
+			log.Println("[DeadLetterFailed]", deadletter.ID, "handler not found for", deadletter.Event)
+			continue
+		}
+
+		b.retryDeadLetter(ctx, *handler, deadletter)
+	}
+}
+
+// retryDeadLetter runs again the handler of the dead letter, while no block
+// is dispatched
+func (b *Web3Client) retryDeadLetter(ctx context.Context, handler EventHandler, deadletter *DeadLetter) {
+
+	b.handleMutex.Lock()
+	defer b.handleMutex.Unlock()
+
+	// dropped by a reorg while waiting
+	if _, err := b.DeadLetters.Get(deadletter.ID); err != nil {
+		return
+	}
+
+	canonical, err := b.isCanonical(ctx, deadletter)
+	if err != nil {
+		log.Println("[DeadLetterFailed]", deadletter.ID, err)
+		return
+	}
+	if !canonical {
+		log.Printf("[DeadLetterReorged] %v block %v is no longer in the chain", deadletter.ID, deadletter.BlockHash.Hex())
+		if err := b.DeadLetters.Delete(deadletter.ID); err != nil {
+			log.Println("[DeadLetterFailed]", deadletter.ID, err)
+		}
+		return
+	}
+
+	log.Printf("[DeadLetterRetry] %v %v attempt %v", deadletter.ID, deadletter.Event, deadletter.Attempts+1)
+	eventlog := deadletter.Log
+	if err := b.runHandler(ctx, handler, &eventlog); err != nil {
+		if ctx.Err() == nil {
+			b.deadLetter(handler, &eventlog, err)
+		}
+		return
+	}
+
+	log.Printf("[DeadLetterRecovered] %v", deadletter.ID)
+	if err := b.DeadLetters.Delete(deadletter.ID); err != nil {
+		log.Println("[DeadLetterFailed]", deadletter.ID, err)
+	}
+}
+
+// isCanonical returns true if the block of the dead letter is still in the
+// chain
+func (b *Web3Client) isCanonical(ctx context.Context, deadletter *DeadLetter) (bool, error) {
+	header, err := b.conn().HeaderByNumber(ctx, new(big.Int).SetUint64(deadletter.Log.BlockNumber))
+	if err != nil {
+		return false, err
+	}
+	return header.Hash() == deadletter.BlockHash, nil
+}
+
+// dropDeadLetters removes the dead letters of a log removed by a reorg
+func (b *Web3Client) dropDeadLetters(eventlog *types.Log) {
+
+	if b.DeadLetters == nil {
+		return
+	}
+
+	b.handleMutex.Lock()
+	defer b.handleMutex.Unlock()
+
+	for _, handler := range b.EventHandlers {
+		id := deadLetterID(b.Name, eventlog, handler.ID)
+		deadletter, err := b.DeadLetters.Get(id)
+		if err == store.ErrNotFound {
+			continue
+		}
+		if err != nil {
+			log.Println("[DeadLetterFailed]", id, err)
+			continue
+		}
+		if deadletter.BlockHash != eventlog.BlockHash {
+			continue
+		}
+		log.Printf("[DeadLetterReorged] %v block %v is no longer in the chain", id, eventlog.BlockHash.Hex())
+		if err := b.DeadLetters.Delete(id); err != nil {
+			log.Println("[DeadLetterFailed]", id, err)
+		}
+	}
+}
+
+// retryLoop retries the due dead letters each RetryInterval until ctx is
+// cancelled
+func (b *Web3Client) retryLoop(ctx context.Context) {
+	for {
+		select {
+		case <-time.After(b.RetryInterval):
+			b.retryDeadLetters(ctx)
+		case <-ctx.Done():
+			return
+		}
+	}
+}
@@ -0,0 +1,77 @@
+package eth
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"testing"
+
+	"github.com/ethereum/go-ethereum/accounts/abi"
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/core/types"
+)
+
+func TestIsRetryable(t *testing.T) {
+
+	tests := []struct {
+		err       error
+		retryable bool
+	}{
+		{fmt.Errorf("connection refused"), true},
+		{ErrReceiptNotRecieved, true},
+		{ErrReceiptStatusFailed, false},
+		{Permanent(fmt.Errorf("bad voucher")), false},
+		{&EventDecodeError{Event: "LogLock", Err: fmt.Errorf("short data")}, false},
+		{&RevertError{Function: "unlock", Reason: "already redeemed"}, false},
+	}
+
+	for _, test := range tests {
+		if IsRetryable(test.err) != test.retryable {
+			t.Errorf("IsRetryable(%v) is %v", test.err, !test.retryable)
+		}
+	}
+
+	if Permanent(nil) != nil {
+		t.Errorf("Permanent(nil) is not nil")
+	}
+}
+
+func TestEventHandlerID(t *testing.T) {
+
+	const events = `[
+		{"type":"event","name":"Log","inputs":[{"name":"s","type":"string","indexed":false}]},
+		{"type":"event","name":"LogLock","inputs":[{"name":"s","type":"string","indexed":false}]}
+	]`
+	parsed, err := abi.JSON(strings.NewReader(events))
+	if err != nil {
+		t.Fatal(err)
+	}
+	address := common.HexToAddress("0x00000000000000000000000000000000000000Ab")
+	contract := &Contract{Abi: parsed, Address: &address}
+
+	handler := func(ctx context.Context, eventlog *types.Log) error { return nil }
+	b := &Web3Client{}
+	for _, event := range []string{"LogLock", "Log", "Log"} {
+		if err := b.RegisterEventHandler(contract, event, handler); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	// the ids do not depend on the registration order of other events
+	expected := []string{
+		"0x00000000000000000000000000000000000000ab-LogLock",
+		"0x00000000000000000000000000000000000000ab-Log",
+		"0x00000000000000000000000000000000000000ab-Log-2",
+	}
+	for i, id := range expected {
+		if b.EventHandlers[i].ID != id {
+			t.Errorf("handler #%v id is %v, expected %v", i, b.EventHandlers[i].ID, id)
+		}
+		if found := b.eventHandler(id); found == nil || found.ID != id {
+			t.Errorf("handler %v not found", id)
+		}
+	}
+	if b.eventHandler("unknown") != nil {
+		t.Errorf("unknown handler found")
+	}
+}
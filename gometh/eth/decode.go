@@ -0,0 +1,162 @@
+package eth
+
+import (
+	"fmt"
+	"reflect"
+	"strings"
+
+	"github.com/ethereum/go-ethereum/accounts/abi"
+	"github.com/ethereum/go-ethereum/core/types"
+)
+
+var (
+	// ErrEventNotFound when the event is not in the contract ABI
+	ErrEventNotFound = fmt.Errorf("Event not found")
+	// ErrEventTopicMismatch when the log was not emitted by the event
+	ErrEventTopicMismatch = fmt.Errorf("Log topic does not match the event")
+	// ErrEventTopicCount when the log has not one topic per indexed argument
+	ErrEventTopicCount = fmt.Errorf("Bad number of topics")
+	// ErrEventData when the log data cannot be decoded
+	ErrEventData = fmt.Errorf("Bad log data")
+	// ErrEventFieldType when the decoded value cannot be set in the field
+	ErrEventFieldType = fmt.Errorf("Bad field type")
+)
+
+// EventDecodeError is returned when a log cannot be decoded into an event,
+// Err is one of the ErrEvent* errors
+type EventDecodeError struct {
+	Event  string
+	Err    error
+	Detail string
+}
+
+func (e *EventDecodeError) Error() string {
+	if e.Detail == "" {
+		return fmt.Sprintf("Decoding %v: %v", e.Event, e.Err)
+	}
+	return fmt.Sprintf("Decoding %v: %v, %v", e.Event, e.Err, e.Detail)
+}
+
+// DecodeEvent decodes the log into out using the ABI definition of the
+// event, both the indexed arguments (from the topics) and the non-indexed
+// ones (from the data). If out is a pointer to a struct, each argument is
+// set in the field with the same name capitalised, or with an `abi:"name"`
+// tag, arguments without field are ignored. If the event has only one
+// argument, out can also be a pointer to its type. Indexed arguments of
+// dynamic types are stored hashed in the topic, so they are decoded as
+// common.Hash.
+func (b *Contract) DecodeEvent(out interface{}, event string, eventlog *types.Log) error {
+
+	fail := func(err error, detail string, args ...interface{}) error {
+		return &EventDecodeError{event, err, fmt.Sprintf(detail, args...)}
+	}
+
+	abievent, ok := b.Abi.Events[event]
+	if !ok {
+		return fail(ErrEventNotFound, "")
+	}
+
+	topics := eventlog.Topics
+	if !abievent.Anonymous {
+		if len(topics) == 0 || topics[0] != abievent.ID {
+			return fail(ErrEventTopicMismatch, "")
+		}
+		topics = topics[1:]
+	}
+
+	indexed := 0
+	for _, arg := range abievent.Inputs {
+		if arg.Indexed {
+			indexed++
+		}
+	}
+	if len(topics) != indexed {
+		return fail(ErrEventTopicCount, "expected %v indexed, got %v", indexed, len(topics))
+	}
+
+	data, err := abievent.Inputs.UnpackValues(eventlog.Data)
+	if err != nil {
+		return fail(ErrEventData, "%v", err)
+	}
+
+	// collect the values of all the arguments in order
+	values := make([]interface{}, len(abievent.Inputs))
+	for i, arg := range abievent.Inputs {
+		if !arg.Indexed {
+			values[i], data = data[0], data[1:]
+			continue
+		}
+		topic := topics[0]
+		topics = topics[1:]
+		switch arg.Type.T {
+		case abi.StringTy, abi.BytesTy, abi.SliceTy, abi.ArrayTy:
+			values[i] = topic
+		default:
+			// a static indexed argument is abi-encoded in its topic
+			unpacked, err := abi.Arguments{{Name: arg.Name, Type: arg.Type}}.UnpackValues(topic[:])
+			if err != nil {
+				return fail(ErrEventData, "topic %v: %v", arg.Name, err)
+			}
+			values[i] = unpacked[0]
+		}
+	}
+
+	target := reflect.ValueOf(out)
+	if target.Kind() != reflect.Ptr || target.IsNil() {
+		return fail(ErrEventFieldType, "non-pointer %T", out)
+	}
+	target = target.Elem()
+
+	if target.Kind() != reflect.Struct && len(values) == 1 {
+		if err := setValue(target, values[0]); err != nil {
+			return fail(ErrEventFieldType, "%v", err)
+		}
+		return nil
+	}
+	if target.Kind() != reflect.Struct {
+		return fail(ErrEventFieldType, "cannot decode into %T", out)
+	}
+
+	for i, arg := range abievent.Inputs {
+		field := eventField(target, arg.Name)
+		if !field.IsValid() {
+			continue
+		}
+		if err := setValue(field, values[i]); err != nil {
+			return fail(ErrEventFieldType, "%v: %v", arg.Name, err)
+		}
+	}
+
+	return nil
+}
+
+// eventField returns the struct field for the argument name
+func eventField(target reflect.Value, name string) reflect.Value {
+	typ := target.Type()
+	for i := 0; i < typ.NumField(); i++ {
+		if tag, ok := typ.Field(i).Tag.Lookup("abi"); ok && tag == name {
+			return target.Field(i)
+		}
+	}
+	name = strings.TrimLeft(name, "_")
+	if name == "" {
+		return reflect.Value{}
+	}
+	return target.FieldByName(strings.ToUpper(name[:1]) + name[1:])
+}
+
+func setValue(dst reflect.Value, value interface{}) error {
+	if !dst.CanSet() {
+		return fmt.Errorf("cannot set unexported field of type %v", dst.Type())
+	}
+	src := reflect.ValueOf(value)
+	switch {
+	case src.Type().AssignableTo(dst.Type()):
+		dst.Set(src)
+	case src.Kind() == dst.Kind() && src.Type().ConvertibleTo(dst.Type()):
+		dst.Set(src.Convert(dst.Type()))
+	default:
+		return fmt.Errorf("cannot set %v into %v", src.Type(), dst.Type())
+	}
+	return nil
+}
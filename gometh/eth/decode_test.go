@@ -0,0 +1,143 @@
+package eth
+
+import (
+	"errors"
+	"math/big"
+	"strings"
+	"testing"
+
+	"github.com/ethereum/go-ethereum/accounts/abi"
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/common/math"
+	"github.com/ethereum/go-ethereum/core/types"
+	"github.com/ethereum/go-ethereum/crypto"
+)
+
+const decodeTestAbi = `[
+	{"type":"event","name":"Transfer","inputs":[
+		{"name":"from","type":"address","indexed":true},
+		{"name":"to","type":"address","indexed":true},
+		{"name":"value","type":"uint256","indexed":false}]},
+	{"type":"event","name":"Named","inputs":[
+		{"name":"name","type":"string","indexed":true},
+		{"name":"_value","type":"uint256","indexed":false}]}
+]`
+
+func decodeTestContract(t *testing.T) *Contract {
+	parsed, err := abi.JSON(strings.NewReader(decodeTestAbi))
+	if err != nil {
+		t.Fatal(err)
+	}
+	return &Contract{Abi: parsed}
+}
+
+func TestDecodeEvent(t *testing.T) {
+
+	contract := decodeTestContract(t)
+	transferID := contract.Abi.Events["Transfer"].ID
+	namedID := contract.Abi.Events["Named"].ID
+
+	from := common.HexToAddress("0x1111111111111111111111111111111111111111")
+	to := common.HexToAddress("0x2222222222222222222222222222222222222222")
+	value := math.U256Bytes(big.NewInt(42))
+	nameHash := crypto.Keccak256Hash([]byte("gometh"))
+
+	transfer := &types.Log{
+		Topics: []common.Hash{transferID, common.BytesToHash(from[:]), common.BytesToHash(to[:])},
+		Data:   value,
+	}
+
+	type Transfer struct {
+		From  common.Address
+		To    common.Address `abi:"to"`
+		Value *big.Int
+	}
+	type Named struct {
+		Name  common.Hash
+		Value *big.Int
+	}
+	type unexported struct {
+		From  common.Address
+		value *big.Int `abi:"value"`
+	}
+	type mistyped struct {
+		Value string
+	}
+
+	tests := []struct {
+		name  string
+		event string
+		log   *types.Log
+		out   interface{}
+		err   error
+		check func(out interface{}) bool
+	}{
+		{
+			name: "ok", event: "Transfer", log: transfer, out: &Transfer{},
+			check: func(out interface{}) bool {
+				t := out.(*Transfer)
+				return t.From == from && t.To == to && t.Value.Int64() == 42
+			},
+		},
+		{
+			name: "indexed dynamic type", event: "Named",
+			log: &types.Log{Topics: []common.Hash{namedID, nameHash}, Data: value},
+			out: &Named{},
+			check: func(out interface{}) bool {
+				n := out.(*Named)
+				return n.Name == nameHash && n.Value.Int64() == 42
+			},
+		},
+		{
+			name: "unknown event", event: "Missing", log: transfer, out: &Transfer{},
+			err: ErrEventNotFound,
+		},
+		{
+			name: "wrong topic0", event: "Transfer",
+			log: &types.Log{Topics: []common.Hash{namedID, {}, {}}, Data: value},
+			out: &Transfer{}, err: ErrEventTopicMismatch,
+		},
+		{
+			name: "no topics", event: "Transfer",
+			log: &types.Log{Data: value}, out: &Transfer{}, err: ErrEventTopicMismatch,
+		},
+		{
+			name: "topic count mismatch", event: "Transfer",
+			log: &types.Log{Topics: []common.Hash{transferID, {}}, Data: value},
+			out: &Transfer{}, err: ErrEventTopicCount,
+		},
+		{
+			name: "truncated data", event: "Transfer",
+			log: &types.Log{Topics: transfer.Topics, Data: value[:16]},
+			out: &Transfer{}, err: ErrEventData,
+		},
+		{
+			name: "unexported field", event: "Transfer", log: transfer, out: &unexported{},
+			err: ErrEventFieldType,
+		},
+		{
+			name: "mistyped field", event: "Transfer", log: transfer, out: &mistyped{},
+			err: ErrEventFieldType,
+		},
+		{
+			name: "non-pointer", event: "Transfer", log: transfer, out: Transfer{},
+			err: ErrEventFieldType,
+		},
+	}
+
+	for _, test := range tests {
+		err := contract.DecodeEvent(test.out, test.event, test.log)
+		if test.err == nil {
+			if err != nil {
+				t.Errorf("%v: unexpected error %v", test.name, err)
+			} else if !test.check(test.out) {
+				t.Errorf("%v: bad decoded value %+v", test.name, test.out)
+			}
+			continue
+		}
+		var decodeErr *EventDecodeError
+		if !errors.As(err, &decodeErr) || decodeErr.Err != test.err {
+			t.Errorf("%v: expected %v, got %v", test.name, test.err, err)
+		}
+	}
+}
@@ -0,0 +1,113 @@
+package eth
+
+import (
+	"context"
+	"sort"
+	"sync"
+
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/core/types"
+)
+
+func sortLogs(logs []types.Log) {
+	sort.SliceStable(logs, func(i, j int) bool {
+		if logs[i].BlockNumber != logs[j].BlockNumber {
+			return logs[i].BlockNumber < logs[j].BlockNumber
+		}
+		return logs[i].Index < logs[j].Index
+	})
+}
+
+// dispatch processes the logs strictly in (block, index) order, skipping the
+// ones already processed. If EventWorkers is greater than one, the logs of
+// a block emitted by different transactions are handled concurrently, with
+// at most EventWorkers at a time, while the logs of a same transaction are
+// still handled in order. The checkpoint only advances when all the logs of
+// the block are handled, and processing stops if ctx is cancelled. The dead
+// letters are not retried while a block is dispatched.
+func (b *Web3Client) dispatch(ctx context.Context, logs []types.Log) {
+
+	sortLogs(logs)
+
+	for start := 0; start < len(logs) && ctx.Err() == nil; {
+		end := start + 1
+		for end < len(logs) && logs[end].BlockNumber == logs[start].BlockNumber {
+			end++
+		}
+		b.handleMutex.Lock()
+		b.dispatchBlock(ctx, logs[start:end])
+		b.handleMutex.Unlock()
+		start = end
+	}
+}
+
+// dispatchBlock processes the sorted logs of a block
+func (b *Web3Client) dispatchBlock(ctx context.Context, logs []types.Log) {
+
+	pending := []*types.Log{}
+	for i := range logs {
+		if !logs[i].Removed && !b.checkpoint.IsProcessed(&logs[i]) {
+			pending = append(pending, &logs[i])
+		}
+	}
+	if len(pending) == 0 {
+		return
+	}
+
+	if b.EventWorkers <= 1 {
+		for _, eventlog := range pending {
+			if !b.handleEvent(ctx, eventlog) {
+				return
+			}
+			b.markProcessed(eventlog)
+		}
+		return
+	}
+
+	txs := []common.Hash{}
+	txlogs := make(map[common.Hash][]*types.Log)
+	for _, eventlog := range pending {
+		if _, ok := txlogs[eventlog.TxHash]; !ok {
+			txs = append(txs, eventlog.TxHash)
+		}
+		txlogs[eventlog.TxHash] = append(txlogs[eventlog.TxHash], eventlog)
+	}
+
+	var wg sync.WaitGroup
+	workers := make(chan bool, b.EventWorkers)
+	for _, tx := range txs {
+		wg.Add(1)
+		workers <- true
+		go func(txlogs []*types.Log) {
+			defer func() {
+				<-workers
+				wg.Done()
+			}()
+			for _, eventlog := range txlogs {
+				if !b.handleEvent(ctx, eventlog) {
+					return
+				}
+			}
+		}(txlogs[tx])
+	}
+	wg.Wait()
+
+	// the block is handled again when resumed
+	if ctx.Err() != nil {
+		return
+	}
+
+	for _, eventlog := range pending {
+		b.markProcessed(eventlog)
+	}
+}
+
+// markProcessed advances the checkpoint to the log
+func (b *Web3Client) markProcessed(eventlog *types.Log) {
+	b.rememberProcessed(eventlog)
+	b.checkpoint = &Checkpoint{
+		Block: eventlog.BlockNumber,
+		Index: eventlog.Index,
+	}
+	b.saveCheckpoint()
+}
@@ -0,0 +1,138 @@
+package eth
+
+import (
+	"context"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/core/types"
+)
+
+func TestSortLogs(t *testing.T) {
+
+	logs := []types.Log{
+		{BlockNumber: 2, Index: 0},
+		{BlockNumber: 1, Index: 5},
+		{BlockNumber: 1, Index: 1, TxHash: common.Hash{1}},
+		{BlockNumber: 1, Index: 1, TxHash: common.Hash{2}},
+		{BlockNumber: 0, Index: 9},
+	}
+	sortLogs(logs)
+
+	expected := []struct {
+		block uint64
+		index uint
+		tx    byte
+	}{
+		{0, 9, 0}, {1, 1, 1}, {1, 1, 2}, {1, 5, 0}, {2, 0, 0},
+	}
+	for i, e := range expected {
+		l := logs[i]
+		if l.BlockNumber != e.block || l.Index != e.index || l.TxHash[0] != e.tx {
+			t.Errorf("log #%v is (%v, %v, %x), expected (%v, %v, %x)", i, l.BlockNumber, l.Index, l.TxHash[0], e.block, e.index, e.tx)
+		}
+	}
+}
+
+func TestDispatchWorkers(t *testing.T) {
+
+	var mutex sync.Mutex
+	running, maxRunning := 0, 0
+	handled := []types.Log{}
+
+	address := common.HexToAddress("0x1111111111111111111111111111111111111111")
+	topic := common.Hash{0xaa}
+	b := &Web3Client{
+		EventWorkers: 2,
+		EventHandlers: []EventHandler{{
+			ID:      "test",
+			Address: address,
+			Topic:   topic.Hex(),
+			Handler: func(ctx context.Context, eventlog *types.Log) error {
+				mutex.Lock()
+				running++
+				if running > maxRunning {
+					maxRunning = running
+				}
+				mutex.Unlock()
+				time.Sleep(10 * time.Millisecond)
+				mutex.Lock()
+				running--
+				handled = append(handled, *eventlog)
+				mutex.Unlock()
+				return nil
+			},
+		}},
+		processed: make(map[logKey]uint64),
+	}
+
+	txlog := func(block uint64, index uint, tx byte) types.Log {
+		return types.Log{Address: address, Topics: []common.Hash{topic}, BlockNumber: block, Index: index, TxHash: common.Hash{tx}}
+	}
+	logs := []types.Log{
+		txlog(2, 0, 4),
+		txlog(1, 0, 1), txlog(1, 1, 2), txlog(1, 2, 1), txlog(1, 3, 3), txlog(1, 4, 1),
+	}
+	b.dispatch(context.Background(), logs)
+
+	if len(handled) != len(logs) {
+		t.Fatalf("handled %v logs of %v", len(handled), len(logs))
+	}
+	if maxRunning < 2 || maxRunning > b.EventWorkers {
+		t.Errorf("%v handlers run at the same time with %v workers", maxRunning, b.EventWorkers)
+	}
+
+	// the logs of a transaction in order, and the blocks one after the other
+	last := make(map[common.Hash]uint)
+	for i, l := range handled {
+		if index, ok := last[l.TxHash]; ok && index > l.Index {
+			t.Errorf("log %v of tx %x handled after log %v", l.Index, l.TxHash[0], index)
+		}
+		last[l.TxHash] = l.Index
+		if l.BlockNumber == 2 && i != len(handled)-1 {
+			t.Errorf("block 2 handled before the end of block 1")
+		}
+	}
+	if b.checkpoint == nil || *b.checkpoint != (Checkpoint{Block: 2, Index: 0}) {
+		t.Errorf("checkpoint is %+v", b.checkpoint)
+	}
+}
+
+func TestDispatchCancelled(t *testing.T) {
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	address := common.HexToAddress("0x1111111111111111111111111111111111111111")
+	topic := common.Hash{0xaa}
+	b := &Web3Client{
+		EventWorkers: 2,
+		EventHandlers: []EventHandler{{
+			ID:      "test",
+			Address: address,
+			Topic:   topic.Hex(),
+			Handler: func(ctx context.Context, eventlog *types.Log) error {
+				if eventlog.BlockNumber == 2 {
+					cancel()
+					return ctx.Err()
+				}
+				return nil
+			},
+		}},
+		processed: make(map[logKey]uint64),
+	}
+
+	logs := []types.Log{
+		{Address: address, Topics: []common.Hash{topic}, BlockNumber: 1, TxHash: common.Hash{1}},
+		{Address: address, Topics: []common.Hash{topic}, BlockNumber: 2, TxHash: common.Hash{1}},
+		{Address: address, Topics: []common.Hash{topic}, BlockNumber: 2, Index: 1, TxHash: common.Hash{2}},
+	}
+	b.dispatch(ctx, logs)
+
+	// the interrupted block is handled again when resumed
+	if b.checkpoint == nil || *b.checkpoint != (Checkpoint{Block: 1, Index: 0}) {
+		t.Errorf("checkpoint is %+v, expected the end of block 1", b.checkpoint)
+	}
+}
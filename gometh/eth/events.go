@@ -0,0 +1,393 @@
+package eth
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"math/big"
+	"time"
+
+	cfg "github.com/adriamb/gometh-server/gometh/config"
+
+	"github.com/ethereum/go-ethereum"
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/core/types"
+)
+
+// eventSubscription are the live subscriptions used to receive events
+type eventSubscription struct {
+	logs    chan types.Log
+	heads   chan *types.Header
+	logsub  ethereum.Subscription
+	headsub ethereum.Subscription
+}
+
+func (s *eventSubscription) unsubscribe() {
+	s.logsub.Unsubscribe()
+	if s.headsub != nil {
+		s.headsub.Unsubscribe()
+	}
+}
+
+func (s *eventSubscription) headErr() <-chan error {
+	if s.headsub == nil {
+		return nil
+	}
+	return s.headsub.Err()
+}
+
+func (b *Web3Client) eventSignature(eventlog *types.Log) string {
+	for _, v := range b.EventHandlers {
+		if eventlog.Address == v.Address && len(eventlog.Topics) > 0 && eventlog.Topics[0].Hex() == v.Topic {
+			return v.EventSignature
+		}
+	}
+	return "unknown"
+}
+
+func (b *Web3Client) saveCheckpoint() {
+	if b.Checkpoints == nil {
+		return
+	}
+	if err := b.Checkpoints.Save(b.checkpointID, *b.checkpoint); err != nil {
+		log.Println("[CheckpointFailed]", b.checkpointID, err)
+	}
+}
+
+// runHandler calls the handler wrapped by the middlewares
+func (b *Web3Client) runHandler(ctx context.Context, event EventHandler, logevent *types.Log) error {
+	handler := event.Handler
+	for i := len(b.Middlewares) - 1; i >= 0; i-- {
+		handler = b.Middlewares[i](event, handler)
+	}
+	return handler(ctx, logevent)
+}
+
+// handleEvent calls all the handlers registered for the log, the failed
+// ones are sent to the dead letter store. It returns false if ctx was
+// cancelled, the log has to be handled again when resumed.
+func (b *Web3Client) handleEvent(ctx context.Context, logevent *types.Log) bool {
+	for _, v := range b.EventHandlers {
+		if logevent.Address != v.Address || len(logevent.Topics) == 0 || logevent.Topics[0].Hex() != v.Topic {
+			continue
+		}
+		if v.Handler == nil {
+			log.Println("[Event] ", v.EventSignature)
+			continue
+		}
+		if err := b.runHandler(ctx, v, logevent); err != nil {
+			if ctx.Err() != nil {
+				log.Println("[EventInterrupted]", v.EventSignature, err)
+				return false
+			}
+			log.Println("[EventProcessingFailed]", v.EventSignature, err)
+			b.deadLetter(v, logevent, err)
+		}
+	}
+	return ctx.Err() == nil
+}
+
+// stopped is called when the event processing terminates
+func (b *Web3Client) stopped(terminatedch chan bool) {
+	b.setState(Stopped, nil)
+	if terminatedch != nil {
+		terminatedch <- true
+	}
+}
+
+// backfill processes the past logs in [from,to], requesting at most
+// BlockWindow blocks each time
+func (b *Web3Client) backfill(ctx context.Context, query ethereum.FilterQuery, from, to uint64, process func(context.Context, []types.Log)) error {
+
+	window := b.BlockWindow
+	if window == 0 {
+		window = 1
+	}
+
+	for start := from; start <= to; start += window {
+		end := start + window - 1
+		if end > to {
+			end = to
+		}
+
+		query.FromBlock = new(big.Int).SetUint64(start)
+		query.ToBlock = new(big.Int).SetUint64(end)
+
+		logs, err := b.conn().FilterLogs(ctx, query)
+		if err != nil {
+			return fmt.Errorf("Failed fetching logs of blocks %v-%v: %w", start, end, err)
+		}
+		if cfg.Verbose > 0 {
+			log.Printf("Backfill %v blocks %v-%v, %v logs", b.Name, start, end, len(logs))
+		}
+		process(ctx, logs)
+		if ctx.Err() != nil {
+			return ctx.Err()
+		}
+	}
+
+	return nil
+}
+
+// resumeBlock returns the first block that may have logs not processed yet
+func (b *Web3Client) resumeBlock() uint64 {
+	if b.checkpoint != nil && b.checkpoint.Block > b.scanFrom {
+		return b.checkpoint.Block
+	}
+	return b.scanFrom
+}
+
+// subscribe starts the live subscriptions and processes the logs emitted
+// since the last checkpoint
+func (b *Web3Client) subscribe(ctx context.Context, query ethereum.FilterQuery) (*eventSubscription, error) {
+
+	var err error
+
+	s := &eventSubscription{
+		logs: make(chan types.Log),
+	}
+
+	// subscribe before reading the head, so the logs after the head are
+	// received by the subscription and the ones until the head by the
+	// backfill, the logs received twice are discarded by the checkpoint
+	if s.logsub, err = b.conn().SubscribeFilterLogs(ctx, query, s.logs); err != nil {
+		return nil, err
+	}
+	if b.Confirmations > 0 {
+		s.heads = make(chan *types.Header)
+		if s.headsub, err = b.conn().SubscribeNewHead(ctx, s.heads); err != nil {
+			s.logsub.Unsubscribe()
+			return nil, err
+		}
+	}
+
+	head, err := b.conn().HeaderByNumber(ctx, nil)
+	if err != nil {
+		s.unsubscribe()
+		return nil, err
+	}
+
+	from := b.resumeBlock()
+
+	// the pending logs are fetched again, since they could be reorged
+	// while disconnected
+	b.pending = make(map[logKey]types.Log)
+
+	// process the confirmed logs, and keep the unconfirmed ones pending
+	last := head.Number.Uint64()
+	unconfirmed := from
+	if last >= from+b.Confirmations {
+		unconfirmed = last - b.Confirmations + 1
+		err = b.backfill(ctx, query, from, unconfirmed-1, b.dispatch)
+	}
+	if err == nil {
+		err = b.backfill(ctx, query, unconfirmed, last, b.receiveEvents)
+	}
+	if err != nil {
+		s.unsubscribe()
+		return nil, err
+	}
+	b.confirmEvents(ctx, last)
+
+	return s, nil
+}
+
+// resubscribe redials the node until the subscriptions are restored, returns
+// nil if ctx is cancelled while trying
+func (b *Web3Client) resubscribe(ctx context.Context, query ethereum.FilterQuery) *eventSubscription {
+
+	backoff := minReconnectBackoff
+	for {
+		select {
+		case <-time.After(backoff):
+		case <-ctx.Done():
+			return nil
+		}
+
+		err := b.redial()
+		if err == nil {
+			var s *eventSubscription
+			if s, err = b.subscribe(ctx, query); err == nil {
+				b.setState(Connected, nil)
+				return s
+			}
+		}
+
+		backoff = nextBackoff(backoff)
+		log.Printf("[ReconnectFailed] %v %v, retrying in %v", b.Name, err, backoff)
+	}
+}
+
+// poll processes the logs of the blocks confirmed since the last poll
+func (b *Web3Client) poll(ctx context.Context, query ethereum.FilterQuery) error {
+
+	head, err := b.conn().HeaderByNumber(ctx, nil)
+	if err != nil {
+		return err
+	}
+	last := head.Number.Uint64()
+	if last < b.Confirmations {
+		return nil
+	}
+	confirmed := last - b.Confirmations
+
+	from := b.resumeBlock()
+	if from > confirmed {
+		return nil
+	}
+	if err := b.backfill(ctx, query, from, confirmed, b.dispatch); err != nil {
+		return err
+	}
+	b.scanFrom = confirmed + 1
+
+	return nil
+}
+
+// pollEvents polls for new logs each PollInterval, used when the node does
+// not support subscriptions
+func (b *Web3Client) pollEvents(ctx context.Context, query ethereum.FilterQuery, terminatedch chan bool) {
+
+	wait := b.PollInterval
+	backoff := minReconnectBackoff
+
+	for {
+		select {
+		case <-time.After(wait):
+		case <-ctx.Done():
+			b.stopped(terminatedch)
+			return
+		}
+
+		err := b.poll(ctx, query)
+		if ctx.Err() != nil {
+			continue
+		}
+		if err == nil {
+			b.setState(Connected, nil)
+			wait = b.PollInterval
+			backoff = minReconnectBackoff
+			continue
+		}
+
+		b.setState(Reconnecting, err)
+		if err = b.redial(); err != nil {
+			log.Printf("[ReconnectFailed] %v %v", b.Name, err)
+		}
+		wait = backoff
+		backoff = nextBackoff(backoff)
+	}
+}
+
+// HandleEvents starts processing event handling, events are processed in
+// order once they are Confirmations blocks deep. If a checkpoint store
+// is set, the events emitted since the last checkpoint are processed before
+// returning. Failed events are stored in DeadLetters, if set, and retried
+// following the RetryPolicy. If the connection is lost, the node is redialed and the
+// processing resumes from the last processed event.
+//
+// If PollInterval is set the node is polled for new logs instead of using
+// subscriptions, in this mode logs removed by reorgs are not notified so
+// Confirmations should be set.
+//
+// The processing stops when ctx is cancelled, then terminatedch, if not
+// nil, is signaled.
+func (b *Web3Client) HandleEvents(ctx context.Context, terminatedch chan bool) error {
+
+	var err error
+
+	addrs := []common.Address{}
+
+	for _, v := range b.EventHandlers {
+		found := false
+		for _, addr := range addrs {
+			if addr == v.Address {
+				found = true
+				break
+			}
+		}
+		if !found {
+			addrs = append(addrs, v.Address)
+		}
+	}
+
+	query := ethereum.FilterQuery{
+		Addresses: addrs,
+		Topics:    [][]common.Hash{{}},
+	}
+
+	b.processed = make(map[logKey]uint64)
+
+	if b.Checkpoints != nil {
+		chainID, err := b.ChainID(ctx)
+		if err != nil {
+			return err
+		}
+		contract := common.Address{}
+		if len(b.EventHandlers) > 0 {
+			contract = b.EventHandlers[0].Address
+		}
+		b.checkpointID = checkpointID(b.Name, chainID, contract)
+		if b.checkpoint, err = b.Checkpoints.Load(b.checkpointID); err != nil {
+			return err
+		}
+		b.scanFrom = b.StartBlock
+		if b.checkpoint != nil {
+			log.Printf("Resuming %v events from block %v index %v", b.Name, b.checkpoint.Block, b.checkpoint.Index)
+		}
+	} else {
+		head, err := b.conn().HeaderByNumber(ctx, nil)
+		if err != nil {
+			return err
+		}
+		b.scanFrom = head.Number.Uint64() + 1
+	}
+
+	if b.DeadLetters != nil {
+		go b.retryLoop(ctx)
+	}
+
+	if b.PollInterval > 0 {
+		if err = b.poll(ctx, query); err != nil {
+			return err
+		}
+		b.setState(Connected, nil)
+		go b.pollEvents(ctx, query, terminatedch)
+		return nil
+	}
+
+	s, err := b.subscribe(ctx, query)
+	if err != nil {
+		return err
+	}
+	b.setState(Connected, nil)
+
+	go func() {
+		for true {
+			var err error
+			select {
+			case logevent := <-s.logs:
+				b.receiveEvent(ctx, &logevent)
+			case head := <-s.heads:
+				b.confirmEvents(ctx, head.Number.Uint64())
+			case err = <-s.logsub.Err():
+			case err = <-s.headErr():
+			case <-ctx.Done():
+				s.unsubscribe()
+				b.stopped(terminatedch)
+				return
+			}
+			if err == nil {
+				continue
+			}
+
+			s.unsubscribe()
+			b.setState(Reconnecting, err)
+			if s = b.resubscribe(ctx, query); s == nil {
+				b.stopped(terminatedch)
+				return
+			}
+		}
+	}()
+
+	return nil
+}
@@ -0,0 +1,122 @@
+package eth
+
+import (
+	"context"
+	"errors"
+	"math/big"
+	"testing"
+
+	"github.com/ethereum/go-ethereum"
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/common/hexutil"
+	"github.com/ethereum/go-ethereum/core/types"
+	"github.com/ethereum/go-ethereum/ethclient"
+	"github.com/ethereum/go-ethereum/rpc"
+)
+
+// pollTestEth is a node with a log in each block
+type pollTestEth struct {
+	head    uint64
+	address common.Address
+	topic   common.Hash
+	// ranges are the blocks requested by each eth_getLogs
+	ranges [][2]uint64
+}
+
+func (s *pollTestEth) GetBlockByNumber(number string, full bool) (*types.Header, error) {
+	return &types.Header{Number: new(big.Int).SetUint64(s.head), Difficulty: big.NewInt(0)}, nil
+}
+
+func (s *pollTestEth) GetLogs(query map[string]interface{}) ([]types.Log, error) {
+	from, err := hexutil.DecodeUint64(query["fromBlock"].(string))
+	if err != nil {
+		return nil, err
+	}
+	to, err := hexutil.DecodeUint64(query["toBlock"].(string))
+	if err != nil {
+		return nil, err
+	}
+	s.ranges = append(s.ranges, [2]uint64{from, to})
+	logs := []types.Log{}
+	for block := from; block <= to; block++ {
+		logs = append(logs, types.Log{
+			Address:     s.address,
+			Topics:      []common.Hash{s.topic},
+			Data:        []byte{},
+			BlockNumber: block,
+			BlockHash:   common.BigToHash(new(big.Int).SetUint64(block)),
+		})
+	}
+	return logs, nil
+}
+
+func TestPoll(t *testing.T) {
+
+	eth := &pollTestEth{
+		head:    10,
+		address: common.HexToAddress("0x1111111111111111111111111111111111111111"),
+		topic:   common.Hash{0xaa},
+	}
+	server := rpc.NewServer()
+	if err := server.RegisterName("eth", eth); err != nil {
+		t.Fatal(err)
+	}
+
+	handled := []uint64{}
+	b := &Web3Client{
+		Client:        ethclient.NewClient(rpc.DialInProc(server)),
+		Confirmations: 2,
+		BlockWindow:   3,
+		EventHandlers: []EventHandler{{
+			ID:      "test",
+			Address: eth.address,
+			Topic:   eth.topic.Hex(),
+			Handler: func(ctx context.Context, eventlog *types.Log) error {
+				handled = append(handled, eventlog.BlockNumber)
+				return nil
+			},
+		}},
+		scanFrom:  2,
+		processed: make(map[logKey]uint64),
+	}
+	query := ethereum.FilterQuery{Addresses: []common.Address{eth.address}}
+
+	// only the confirmed blocks, in windows of BlockWindow blocks
+	if err := b.poll(context.Background(), query); err != nil {
+		t.Fatal(err)
+	}
+	expected := [][2]uint64{{2, 4}, {5, 7}, {8, 8}}
+	if len(eth.ranges) != len(expected) {
+		t.Fatalf("requested %v, expected %v", eth.ranges, expected)
+	}
+	for i := range expected {
+		if eth.ranges[i] != expected[i] {
+			t.Errorf("requested %v, expected %v", eth.ranges, expected)
+			break
+		}
+	}
+	if len(handled) != 7 || b.scanFrom != 9 {
+		t.Errorf("handled blocks %v, next poll from %v", handled, b.scanFrom)
+	}
+
+	// nothing new is confirmed
+	eth.ranges = nil
+	if err := b.poll(context.Background(), query); err != nil || len(eth.ranges) != 0 {
+		t.Errorf("polled %v without new blocks, %v", eth.ranges, err)
+	}
+
+	eth.head = 12
+	if err := b.poll(context.Background(), query); err != nil {
+		t.Fatal(err)
+	}
+	if len(eth.ranges) != 1 || eth.ranges[0] != [2]uint64{9, 10} || len(handled) != 9 {
+		t.Errorf("requested %v handling %v", eth.ranges, handled)
+	}
+
+	// interrupted while fetching, a clean stop for the callers
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	if err := b.backfill(ctx, query, 11, 20, b.dispatch); !errors.Is(err, context.Canceled) {
+		t.Errorf("cancelled backfill returned %v", err)
+	}
+}
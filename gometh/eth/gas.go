@@ -0,0 +1,315 @@
+package eth
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"math/big"
+	"sort"
+	"sync"
+
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/core/types"
+	"github.com/ethereum/go-ethereum/rpc"
+)
+
+// TxType selects the kind of transactions sent to a chain
+type TxType string
+
+const (
+	// TxTypeAuto sends dynamic fee transactions if the chain supports them
+	TxTypeAuto TxType = "auto"
+	// TxTypeLegacy sends gas price transactions
+	TxTypeLegacy TxType = "legacy"
+	// TxTypeDynamic sends EIP-1559 dynamic fee transactions
+	TxTypeDynamic TxType = "dynamic"
+)
+
+var (
+	// ErrNoBaseFee when dynamic fee transactions are used in a chain without EIP-1559
+	ErrNoBaseFee = fmt.Errorf("Chain has no base fee")
+)
+
+// Fees are the fees of a transaction, GasPrice is set for legacy
+// transactions, and GasFeeCap and GasTipCap for dynamic fee ones
+type Fees struct {
+	GasPrice  *big.Int
+	GasFeeCap *big.Int
+	GasTipCap *big.Int
+}
+
+// Dynamic returns true if the fees are for a dynamic fee transaction
+func (f *Fees) Dynamic() bool {
+	return f.GasFeeCap != nil
+}
+
+func (f *Fees) String() string {
+	if f.Dynamic() {
+		return fmt.Sprintf("feecap=%v tipcap=%v", f.GasFeeCap, f.GasTipCap)
+	}
+	return fmt.Sprintf("gasprice=%v", f.GasPrice)
+}
+
+// GasStrategy computes the fees of the transactions sent to a chain, if
+// dynamic is set the fees are for a dynamic fee transaction and baseFee is
+// the base fee of the last block
+type GasStrategy interface {
+	Fees(ctx context.Context, client *Web3Client, dynamic bool, baseFee *big.Int) (*Fees, error)
+}
+
+// GasCaps are the max fees paid by the transactions, nil means no cap
+type GasCaps struct {
+	MaxGasPrice  *big.Int
+	MaxGasFeeCap *big.Int
+	MaxGasTipCap *big.Int
+}
+
+func capFee(fee, max *big.Int) *big.Int {
+	if fee == nil || max == nil || fee.Cmp(max) <= 0 {
+		return fee
+	}
+	return new(big.Int).Set(max)
+}
+
+// Apply limits the fees to the caps
+func (c *GasCaps) Apply(fees *Fees) *Fees {
+	capped := &Fees{
+		GasPrice:  capFee(fees.GasPrice, c.MaxGasPrice),
+		GasFeeCap: capFee(fees.GasFeeCap, c.MaxGasFeeCap),
+		GasTipCap: capFee(fees.GasTipCap, c.MaxGasTipCap),
+	}
+	if capped.Dynamic() && capped.GasTipCap.Cmp(capped.GasFeeCap) > 0 {
+		capped.GasTipCap = new(big.Int).Set(capped.GasFeeCap)
+	}
+	return capped
+}
+
+// dynamicFeeCap is the fee cap for a tip, allowing the base fee to double
+func dynamicFeeCap(baseFee, tip *big.Int) *big.Int {
+	feeCap := new(big.Int).Mul(baseFee, big.NewInt(2))
+	return feeCap.Add(feeCap, tip)
+}
+
+// FixedGasStrategy always uses the same fees
+type FixedGasStrategy struct {
+	GasPrice  *big.Int
+	GasFeeCap *big.Int
+	GasTipCap *big.Int
+}
+
+// Fees returns the fixed fees, for dynamic fee transactions if GasFeeCap is
+// not set it is computed from the base fee. Legacy transactions without
+// GasPrice pay the tip over the base fee, if any, up to GasFeeCap.
+func (s *FixedGasStrategy) Fees(ctx context.Context, client *Web3Client, dynamic bool, baseFee *big.Int) (*Fees, error) {
+	if !dynamic && (s.GasPrice != nil || s.GasTipCap == nil) {
+		return &Fees{GasPrice: s.GasPrice}, nil
+	}
+	if !dynamic {
+		gasPrice := s.GasTipCap
+		if baseFee != nil {
+			gasPrice = capFee(dynamicFeeCap(baseFee, s.GasTipCap), s.GasFeeCap)
+		}
+		return &Fees{GasPrice: gasPrice}, nil
+	}
+	tip := s.GasTipCap
+	if tip == nil {
+		tip = s.GasPrice
+	}
+	feeCap := s.GasFeeCap
+	if feeCap == nil {
+		feeCap = dynamicFeeCap(baseFee, tip)
+	}
+	return &Fees{GasFeeCap: feeCap, GasTipCap: tip}, nil
+}
+
+// OracleGasStrategy uses the fees suggested by the node
+type OracleGasStrategy struct{}
+
+// Fees returns the gas price or tip suggested by the node
+func (s *OracleGasStrategy) Fees(ctx context.Context, client *Web3Client, dynamic bool, baseFee *big.Int) (*Fees, error) {
+	if !dynamic {
+		gasPrice, err := client.conn().SuggestGasPrice(ctx)
+		if err != nil {
+			return nil, err
+		}
+		return &Fees{GasPrice: gasPrice}, nil
+	}
+	tip, err := client.conn().SuggestGasTipCap(ctx)
+	if err != nil {
+		return nil, err
+	}
+	return &Fees{GasFeeCap: dynamicFeeCap(baseFee, tip), GasTipCap: tip}, nil
+}
+
+// PercentileGasStrategy uses a percentile of the gas prices, or tips, paid
+// in the last Blocks blocks
+type PercentileGasStrategy struct {
+	Blocks     int
+	Percentile float64
+
+	// the gas price of the last head, the blocks are only fetched again
+	// when there is a new one
+	mutex     sync.Mutex
+	head      uint64
+	headPrice *big.Int
+}
+
+// Fees returns the percentile of the recent gas prices or tips
+func (s *PercentileGasStrategy) Fees(ctx context.Context, client *Web3Client, dynamic bool, baseFee *big.Int) (*Fees, error) {
+
+	if dynamic {
+		history, err := client.conn().FeeHistory(ctx, uint64(s.Blocks), nil, []float64{s.Percentile})
+		if err != nil {
+			return nil, err
+		}
+		tips := []*big.Int{}
+		for _, reward := range history.Reward {
+			if len(reward) > 0 {
+				tips = append(tips, reward[0])
+			}
+		}
+		tip := median(tips)
+		if tip == nil {
+			if tip, err = client.conn().SuggestGasTipCap(ctx); err != nil {
+				return nil, err
+			}
+		}
+		return &Fees{GasFeeCap: dynamicFeeCap(baseFee, tip), GasTipCap: tip}, nil
+	}
+
+	head, err := client.conn().BlockNumber(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	if s.headPrice != nil && s.head == head {
+		return &Fees{GasPrice: s.headPrice}, nil
+	}
+
+	prices := []*big.Int{}
+	for i := uint64(0); i < uint64(s.Blocks) && i <= head; i++ {
+		block, err := client.conn().BlockByNumber(ctx, new(big.Int).SetUint64(head-i))
+		if err != nil {
+			return nil, err
+		}
+		for _, tx := range block.Transactions() {
+			prices = append(prices, tx.GasPrice())
+		}
+	}
+	if len(prices) == 0 {
+		gasPrice, err := client.conn().SuggestGasPrice(ctx)
+		if err != nil {
+			return nil, err
+		}
+		return &Fees{GasPrice: gasPrice}, nil
+	}
+	sort.Slice(prices, func(i, j int) bool { return prices[i].Cmp(prices[j]) < 0 })
+	index := int(float64(len(prices)-1) * s.Percentile / 100)
+	s.head, s.headPrice = head, prices[index]
+	return &Fees{GasPrice: prices[index]}, nil
+}
+
+func median(values []*big.Int) *big.Int {
+	if len(values) == 0 {
+		return nil
+	}
+	sort.Slice(values, func(i, j int) bool { return values[i].Cmp(values[j]) < 0 })
+	return values[len(values)/2]
+}
+
+// ZeroGasStrategy sends transactions for free, used in chains where the
+// validators mine with zero gas price
+type ZeroGasStrategy struct{}
+
+// Fees returns zero fees
+func (s *ZeroGasStrategy) Fees(ctx context.Context, client *Web3Client, dynamic bool, baseFee *big.Int) (*Fees, error) {
+	if !dynamic {
+		return &Fees{GasPrice: big.NewInt(0)}, nil
+	}
+	return &Fees{GasFeeCap: new(big.Int).Set(baseFee), GasTipCap: big.NewInt(0)}, nil
+}
+
+// methodNotFound is the json-rpc error code of an unknown method
+const methodNotFound = -32601
+
+// ChainID returns the chain id used to sign transactions, nodes without
+// eth_chainId use the network id, that is not cached
+func (b *Web3Client) ChainID(ctx context.Context) (*big.Int, error) {
+	b.connMutex.RLock()
+	chainID := b.chainID
+	b.connMutex.RUnlock()
+	if chainID != nil {
+		return chainID, nil
+	}
+
+	chainID, err := b.conn().ChainID(ctx)
+	if err != nil {
+		var rpcErr rpc.Error
+		if !errors.As(err, &rpcErr) || rpcErr.ErrorCode() != methodNotFound {
+			return nil, err
+		}
+		return b.conn().NetworkID(ctx)
+	}
+
+	b.connMutex.Lock()
+	b.chainID = chainID
+	b.connMutex.Unlock()
+	return chainID, nil
+}
+
+// Fees returns the fees for a new transaction using the gas strategy, capped
+func (b *Web3Client) Fees(ctx context.Context) (*Fees, error) {
+
+	head, err := b.conn().HeaderByNumber(ctx, nil)
+	if err != nil {
+		return nil, err
+	}
+
+	dynamic := false
+	switch b.TxType {
+	case TxTypeDynamic:
+		if head.BaseFee == nil {
+			return nil, ErrNoBaseFee
+		}
+		dynamic = true
+	case TxTypeLegacy:
+	default:
+		dynamic = head.BaseFee != nil
+	}
+
+	strategy := b.GasStrategy
+	if strategy == nil {
+		strategy = &OracleGasStrategy{}
+	}
+	fees, err := strategy.Fees(ctx, b, dynamic, head.BaseFee)
+	if err != nil {
+		return nil, err
+	}
+	return b.GasCaps.Apply(fees), nil
+}
+
+// newTransaction creates a transaction with the fees, to nil creates a contract
+func newTransaction(chainID *big.Int, nonce uint64, to *common.Address, value *big.Int, gasLimit uint64, fees *Fees, data []byte) *types.Transaction {
+	if fees.Dynamic() {
+		return types.NewTx(&types.DynamicFeeTx{
+			ChainID:   chainID,
+			Nonce:     nonce,
+			GasTipCap: fees.GasTipCap,
+			GasFeeCap: fees.GasFeeCap,
+			Gas:       gasLimit,
+			To:        to,
+			Value:     value,
+			Data:      data,
+		})
+	}
+	return types.NewTx(&types.LegacyTx{
+		Nonce:    nonce,
+		GasPrice: fees.GasPrice,
+		Gas:      gasLimit,
+		To:       to,
+		Value:    value,
+		Data:     data,
+	})
+}
@@ -0,0 +1,291 @@
+package eth
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"math/big"
+	"testing"
+
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/common/hexutil"
+	"github.com/ethereum/go-ethereum/core/types"
+	"github.com/ethereum/go-ethereum/ethclient"
+	"github.com/ethereum/go-ethereum/rpc"
+)
+
+func equalFee(a, b *big.Int) bool {
+	if a == nil || b == nil {
+		return a == b
+	}
+	return a.Cmp(b) == 0
+}
+
+func TestGasCapsApply(t *testing.T) {
+
+	caps := &GasCaps{
+		MaxGasPrice:  big.NewInt(100),
+		MaxGasFeeCap: big.NewInt(200),
+		MaxGasTipCap: big.NewInt(50),
+	}
+
+	tests := []struct {
+		name     string
+		caps     *GasCaps
+		fees     *Fees
+		expected *Fees
+	}{
+		{
+			name:     "legacy under cap",
+			caps:     caps,
+			fees:     &Fees{GasPrice: big.NewInt(90)},
+			expected: &Fees{GasPrice: big.NewInt(90)},
+		},
+		{
+			name:     "legacy over cap",
+			caps:     caps,
+			fees:     &Fees{GasPrice: big.NewInt(150)},
+			expected: &Fees{GasPrice: big.NewInt(100)},
+		},
+		{
+			name:     "dynamic over caps",
+			caps:     caps,
+			fees:     &Fees{GasFeeCap: big.NewInt(300), GasTipCap: big.NewInt(80)},
+			expected: &Fees{GasFeeCap: big.NewInt(200), GasTipCap: big.NewInt(50)},
+		},
+		{
+			name:     "tip over capped fee cap",
+			caps:     &GasCaps{MaxGasFeeCap: big.NewInt(20)},
+			fees:     &Fees{GasFeeCap: big.NewInt(100), GasTipCap: big.NewInt(30)},
+			expected: &Fees{GasFeeCap: big.NewInt(20), GasTipCap: big.NewInt(20)},
+		},
+		{
+			name:     "no caps",
+			caps:     &GasCaps{},
+			fees:     &Fees{GasFeeCap: big.NewInt(300), GasTipCap: big.NewInt(80)},
+			expected: &Fees{GasFeeCap: big.NewInt(300), GasTipCap: big.NewInt(80)},
+		},
+	}
+
+	for _, test := range tests {
+		capped := test.caps.Apply(test.fees)
+		if !equalFee(capped.GasPrice, test.expected.GasPrice) ||
+			!equalFee(capped.GasFeeCap, test.expected.GasFeeCap) ||
+			!equalFee(capped.GasTipCap, test.expected.GasTipCap) {
+			t.Errorf("%v: got %+v, expected %+v", test.name, capped, test.expected)
+		}
+	}
+
+	// the caps must not modify the fees
+	fees := &Fees{GasPrice: big.NewInt(150)}
+	caps.Apply(fees).GasPrice.SetInt64(1)
+	if fees.GasPrice.Int64() != 150 || caps.MaxGasPrice.Int64() != 100 {
+		t.Errorf("Apply modified its inputs")
+	}
+}
+
+func TestBumpFee(t *testing.T) {
+
+	tests := []struct {
+		fee      *big.Int
+		percent  int64
+		expected *big.Int
+	}{
+		{nil, 10, nil},
+		{big.NewInt(0), 10, big.NewInt(1)},
+		{big.NewInt(100), 10, big.NewInt(111)},
+		{big.NewInt(15), 10, big.NewInt(17)},
+		{big.NewInt(1000000000), 12, big.NewInt(1120000001)},
+	}
+
+	for _, test := range tests {
+		bumped := bumpFee(test.fee, test.percent)
+		if !equalFee(bumped, test.expected) {
+			t.Errorf("bumpFee(%v, %v) = %v, expected %v", test.fee, test.percent, bumped, test.expected)
+		}
+		// the replacement must pay at least percent more than the original
+		if test.fee != nil {
+			min := new(big.Int).Mul(test.fee, big.NewInt(100+test.percent))
+			if new(big.Int).Mul(bumped, big.NewInt(100)).Cmp(min) < 0 {
+				t.Errorf("bumpFee(%v, %v) = %v is below the minimum bump", test.fee, test.percent, bumped)
+			}
+		}
+	}
+}
+
+type chainIDTestNet struct{}
+
+func (s *chainIDTestNet) Version() string { return "5" }
+
+type chainIDTestEth struct{ err error }
+
+func (s *chainIDTestEth) ChainId() (*hexutil.Big, error) {
+	return (*hexutil.Big)(big.NewInt(1337)), s.err
+}
+
+func TestChainIDFallback(t *testing.T) {
+
+	client := func(eth interface{}) *Web3Client {
+		server := rpc.NewServer()
+		if err := server.RegisterName("net", &chainIDTestNet{}); err != nil {
+			t.Fatal(err)
+		}
+		if eth != nil {
+			if err := server.RegisterName("eth", eth); err != nil {
+				t.Fatal(err)
+			}
+		}
+		return &Web3Client{Client: ethclient.NewClient(rpc.DialInProc(server))}
+	}
+	ctx := context.Background()
+
+	// nodes without eth_chainId use the network id, not cached
+	b := client(nil)
+	chainID, err := b.ChainID(ctx)
+	if err != nil || chainID.Int64() != 5 {
+		t.Errorf("without eth_chainId got %v, %v", chainID, err)
+	}
+	if b.chainID != nil {
+		t.Errorf("network id was cached")
+	}
+
+	b = client(&chainIDTestEth{})
+	if chainID, err = b.ChainID(ctx); err != nil || chainID.Int64() != 1337 {
+		t.Errorf("with eth_chainId got %v, %v", chainID, err)
+	}
+	if b.chainID == nil {
+		t.Errorf("chain id was not cached")
+	}
+
+	// other errors are returned
+	b = client(&chainIDTestEth{err: errors.New("timeout")})
+	if chainID, err = b.ChainID(ctx); err == nil {
+		t.Errorf("eth_chainId error fell back to %v", chainID)
+	}
+}
+
+func TestFixedGasStrategy(t *testing.T) {
+
+	tests := []struct {
+		name     string
+		strategy *FixedGasStrategy
+		dynamic  bool
+		baseFee  *big.Int
+		expected *Fees
+	}{
+		{
+			name:     "legacy price",
+			strategy: &FixedGasStrategy{GasPrice: big.NewInt(20), GasTipCap: big.NewInt(2)},
+			expected: &Fees{GasPrice: big.NewInt(20)},
+		},
+		{
+			name:     "legacy chain with only the tip",
+			strategy: &FixedGasStrategy{GasTipCap: big.NewInt(2)},
+			expected: &Fees{GasPrice: big.NewInt(2)},
+		},
+		{
+			name:     "legacy transaction with only the tip",
+			strategy: &FixedGasStrategy{GasTipCap: big.NewInt(2)},
+			baseFee:  big.NewInt(10),
+			expected: &Fees{GasPrice: big.NewInt(22)},
+		},
+		{
+			name:     "legacy transaction with the tip over the fee cap",
+			strategy: &FixedGasStrategy{GasTipCap: big.NewInt(2), GasFeeCap: big.NewInt(15)},
+			baseFee:  big.NewInt(10),
+			expected: &Fees{GasPrice: big.NewInt(15)},
+		},
+		{
+			name:     "dynamic with the price as tip",
+			strategy: &FixedGasStrategy{GasPrice: big.NewInt(3)},
+			dynamic:  true,
+			baseFee:  big.NewInt(10),
+			expected: &Fees{GasFeeCap: big.NewInt(23), GasTipCap: big.NewInt(3)},
+		},
+		{
+			name:     "dynamic fee cap",
+			strategy: &FixedGasStrategy{GasTipCap: big.NewInt(2), GasFeeCap: big.NewInt(15)},
+			dynamic:  true,
+			baseFee:  big.NewInt(10),
+			expected: &Fees{GasFeeCap: big.NewInt(15), GasTipCap: big.NewInt(2)},
+		},
+	}
+
+	for _, test := range tests {
+		fees, err := test.strategy.Fees(context.Background(), nil, test.dynamic, test.baseFee)
+		if err != nil {
+			t.Errorf("%v: %v", test.name, err)
+			continue
+		}
+		if !equalFee(fees.GasPrice, test.expected.GasPrice) ||
+			!equalFee(fees.GasFeeCap, test.expected.GasFeeCap) ||
+			!equalFee(fees.GasTipCap, test.expected.GasTipCap) {
+			t.Errorf("%v: got %+v, expected %+v", test.name, fees, test.expected)
+		}
+	}
+}
+
+// percentileTestEth is a legacy chain whose blocks have a transaction with
+// the block number as gas price
+type percentileTestEth struct {
+	head   uint64
+	blocks int
+}
+
+func (s *percentileTestEth) BlockNumber() hexutil.Uint64 {
+	return hexutil.Uint64(s.head)
+}
+
+func (s *percentileTestEth) GetBlockByNumber(number hexutil.Uint64, full bool) (map[string]interface{}, error) {
+	s.blocks++
+	header, err := json.Marshal(&types.Header{
+		Number:     new(big.Int).SetUint64(uint64(number)),
+		Difficulty: big.NewInt(0),
+		UncleHash:  types.EmptyUncleHash,
+		TxHash:     common.Hash{1},
+	})
+	if err != nil {
+		return nil, err
+	}
+	var block map[string]interface{}
+	if err := json.Unmarshal(header, &block); err != nil {
+		return nil, err
+	}
+	tx := types.NewTx(&types.LegacyTx{GasPrice: new(big.Int).SetUint64(uint64(number))})
+	block["transactions"] = []*types.Transaction{tx}
+	block["uncles"] = []common.Hash{}
+	return block, nil
+}
+
+func TestPercentileGasStrategyCache(t *testing.T) {
+
+	eth := &percentileTestEth{head: 10}
+	server := rpc.NewServer()
+	if err := server.RegisterName("eth", eth); err != nil {
+		t.Fatal(err)
+	}
+	b := &Web3Client{Client: ethclient.NewClient(rpc.DialInProc(server))}
+	strategy := &PercentileGasStrategy{Blocks: 3, Percentile: 100}
+
+	fees := func() *big.Int {
+		fees, err := strategy.Fees(context.Background(), b, false, nil)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return fees.GasPrice
+	}
+
+	if price := fees(); price.Int64() != 10 || eth.blocks != 3 {
+		t.Errorf("got %v fetching %v blocks", price, eth.blocks)
+	}
+
+	// the blocks are not fetched again for the same head
+	if price := fees(); price.Int64() != 10 || eth.blocks != 3 {
+		t.Errorf("same head got %v fetching %v blocks", price, eth.blocks)
+	}
+
+	eth.head = 11
+	if price := fees(); price.Int64() != 11 || eth.blocks != 6 {
+		t.Errorf("new head got %v fetching %v blocks", price, eth.blocks)
+	}
+}
@@ -0,0 +1,87 @@
+package eth
+
+import (
+	"context"
+	"expvar"
+	"fmt"
+	"log"
+	"runtime/debug"
+	"time"
+
+	"github.com/ethereum/go-ethereum/core/types"
+)
+
+// EventMiddleware wraps the handler of an event, middlewares are used to add
+// behaviour to all handlers, like logging or metrics
+type EventMiddleware func(event EventHandler, next EventHandlerFunc) EventHandlerFunc
+
+// Use adds middlewares to the event handlers, the first one is the outermost
+func (b *Web3Client) Use(middlewares ...EventMiddleware) {
+	b.Middlewares = append(b.Middlewares, middlewares...)
+}
+
+// RecoverMiddleware converts a panic in the handler into an error
+func RecoverMiddleware(event EventHandler, next EventHandlerFunc) EventHandlerFunc {
+	return func(ctx context.Context, eventlog *types.Log) (err error) {
+		defer func() {
+			if r := recover(); r != nil {
+				log.Printf("[EventHandlerPanic] %v %v\n%s", event.EventSignature, r, debug.Stack())
+				err = fmt.Errorf("Handler panic: %v", r)
+			}
+		}()
+		return next(ctx, eventlog)
+	}
+}
+
+// TimingMiddleware logs the handlers that take longer than threshold
+func TimingMiddleware(threshold time.Duration) EventMiddleware {
+	return func(event EventHandler, next EventHandlerFunc) EventHandlerFunc {
+		return func(ctx context.Context, eventlog *types.Log) error {
+			start := time.Now()
+			err := next(ctx, eventlog)
+			if elapsed := time.Since(start); elapsed > threshold {
+				log.Printf("[EventHandlerSlow] %v took %v", event.EventSignature, elapsed)
+			}
+			return err
+		}
+	}
+}
+
+// LoggingMiddleware logs each handled event with its outcome
+func LoggingMiddleware(chain string) EventMiddleware {
+	return func(event EventHandler, next EventHandlerFunc) EventHandlerFunc {
+		return func(ctx context.Context, eventlog *types.Log) error {
+			start := time.Now()
+			err := next(ctx, eventlog)
+			result := "ok"
+			if err != nil {
+				result = err.Error()
+			}
+			log.Printf("[EventHandled] chain=%v event=%v block=%v index=%v tx=%v elapsed=%v result=%q",
+				chain, event.EventSignature, eventlog.BlockNumber, eventlog.Index,
+				eventlog.TxHash.Hex(), time.Since(start), result,
+			)
+			return err
+		}
+	}
+}
+
+var eventMetrics = expvar.NewMap("events")
+
+// MetricsMiddleware counts the handled and failed events and the time spent
+// handling them, published by expvar as events.<chain>.<event>.<metric>
+func MetricsMiddleware(chain string) EventMiddleware {
+	return func(event EventHandler, next EventHandlerFunc) EventHandlerFunc {
+		prefix := chain + "." + event.EventSignature + "."
+		return func(ctx context.Context, eventlog *types.Log) error {
+			start := time.Now()
+			err := next(ctx, eventlog)
+			eventMetrics.Add(prefix+"handled", 1)
+			eventMetrics.Add(prefix+"microseconds", int64(time.Since(start)/time.Microsecond))
+			if err != nil {
+				eventMetrics.Add(prefix+"failed", 1)
+			}
+			return err
+		}
+	}
+}
@@ -0,0 +1,194 @@
+package eth
+
+import (
+	"context"
+	"log"
+	"math/big"
+	"sort"
+	"strings"
+	"sync"
+
+	"github.com/ethereum/go-ethereum"
+	"github.com/ethereum/go-ethereum/accounts"
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/core/types"
+)
+
+// NonceManager hands out locally the nonces of an account in a chain, so
+// several transactions can be pending at the same time
+type NonceManager struct {
+	mutex   sync.Mutex
+	client  *Web3Client
+	account accounts.Account
+	synced  bool
+	next    uint64
+	// gaps are nonces handed out but not used, the transactions after them
+	// are blocked until they are filled
+	gaps []uint64
+	// released are the hashes of the transactions signed with the gaps, if
+	// the node has one of them the gap is already used
+	released map[uint64]common.Hash
+}
+
+// NewNonceManager creates a nonce manager for the account
+func NewNonceManager(client *Web3Client, account accounts.Account) *NonceManager {
+	return &NonceManager{
+		client:  client,
+		account: account,
+	}
+}
+
+// nonceManagers are the nonce managers of the process by chain id and
+// account, so clients of the same chain do not hand out the same nonces
+var nonceManagers = struct {
+	mutex    sync.Mutex
+	managers map[string]*NonceManager
+}{managers: make(map[string]*NonceManager)}
+
+// nonceManager returns the nonce manager of the account in the chain
+func (b *Web3Client) nonceManager(chainID *big.Int, account accounts.Account) *NonceManager {
+	nonceManagers.mutex.Lock()
+	defer nonceManagers.mutex.Unlock()
+
+	key := chainID.String() + "-" + strings.ToLower(account.Address.Hex())
+	if _, ok := nonceManagers.managers[key]; !ok {
+		nonceManagers.managers[key] = NewNonceManager(b, account)
+	}
+	return nonceManagers.managers[key]
+}
+
+// Next returns the nonce to be used by a new transaction, the lowest gap is
+// returned first if there is any
+func (n *NonceManager) Next(ctx context.Context) (uint64, error) {
+	n.mutex.Lock()
+	defer n.mutex.Unlock()
+
+	if !n.synced {
+		if err := n.resync(ctx); err != nil {
+			return 0, err
+		}
+	}
+	if len(n.gaps) > 0 {
+		nonce := n.gaps[0]
+		n.gaps = n.gaps[1:]
+		return nonce, nil
+	}
+	nonce := n.next
+	n.next++
+	return nonce, nil
+}
+
+// Release returns a nonce whose transaction was not sent, tx is the signed
+// transaction if any, in case it reached the node anyway
+func (n *NonceManager) Release(nonce uint64, tx *types.Transaction) {
+	n.mutex.Lock()
+	defer n.mutex.Unlock()
+
+	if nonce+1 == n.next {
+		n.next--
+		return
+	}
+	if nonce < n.next {
+		n.gaps = append(n.gaps, nonce)
+		sort.Slice(n.gaps, func(i, j int) bool { return n.gaps[i] < n.gaps[j] })
+		if tx != nil {
+			if n.released == nil {
+				n.released = make(map[uint64]common.Hash)
+			}
+			n.released[nonce] = tx.Hash()
+		}
+	}
+}
+
+// Resync reads the pending nonce from the node, and fills the gaps that are
+// blocking the pending transactions
+func (n *NonceManager) Resync(ctx context.Context) error {
+	n.mutex.Lock()
+	defer n.mutex.Unlock()
+
+	return n.resync(ctx)
+}
+
+func (n *NonceManager) resync(ctx context.Context) error {
+
+	pending, err := n.client.conn().PendingNonceAt(ctx, n.account.Address)
+	if err != nil {
+		n.synced = false
+		return err
+	}
+
+	// transactions sent by others, or nonces already used
+	if !n.synced || pending > n.next {
+		n.next = pending
+	}
+	n.synced = true
+
+	gaps := []uint64{}
+	for _, nonce := range n.gaps {
+		if nonce >= pending && nonce < n.next {
+			gaps = append(gaps, nonce)
+		} else {
+			delete(n.released, nonce)
+		}
+	}
+	n.gaps = gaps
+
+	return n.fillGaps(ctx)
+}
+
+// fillGaps sends empty transactions with the nonces of the gaps, unless the
+// transaction released with the nonce reached the node
+func (n *NonceManager) fillGaps(ctx context.Context) error {
+
+	for len(n.gaps) > 0 {
+		nonce := n.gaps[0]
+
+		if hash, ok := n.released[nonce]; ok {
+			_, _, err := n.client.conn().TransactionByHash(ctx, hash)
+			if err == nil {
+				log.Printf("[NonceGap] %v nonce %v of %v is used by %v", n.client.Name, nonce, n.account.Address.Hex(), hash.Hex())
+				n.gaps = n.gaps[1:]
+				delete(n.released, nonce)
+				continue
+			}
+			if err != ethereum.NotFound {
+				return err
+			}
+		}
+
+		log.Printf("[NonceGap] %v filling nonce %v of %v", n.client.Name, nonce, n.account.Address.Hex())
+
+		fees, err := n.client.Fees(ctx)
+		if err != nil {
+			return err
+		}
+		chainID, err := n.client.ChainID(ctx)
+		if err != nil {
+			return err
+		}
+		tx := newTransaction(chainID, nonce, &n.account.Address, big.NewInt(0), 21000, fees, nil)
+		if tx, err = n.client.Signer.SignTx(tx, chainID); err != nil {
+			return err
+		}
+		if err = n.client.conn().SendTransaction(ctx, tx); err != nil && !isKnownTransaction(err) && !isNonceError(err) {
+			return err
+		}
+		n.gaps = n.gaps[1:]
+		delete(n.released, nonce)
+	}
+
+	return nil
+}
+
+// isAlreadyKnown returns true if the node already has the transaction
+func isAlreadyKnown(err error) bool {
+	msg := strings.ToLower(err.Error())
+	return strings.Contains(msg, "already known") ||
+		strings.Contains(msg, "known transaction")
+}
+
+func isNonceError(err error) bool {
+	msg := strings.ToLower(err.Error())
+	return strings.Contains(msg, "nonce too low") ||
+		strings.Contains(msg, "replacement transaction underpriced")
+}
@@ -0,0 +1,61 @@
+package eth
+
+import (
+	"context"
+	"math/big"
+	"testing"
+
+	"github.com/ethereum/go-ethereum/accounts"
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/core/types"
+)
+
+func TestNonceManagerNextRelease(t *testing.T) {
+
+	ctx := context.Background()
+	n := &NonceManager{synced: true, next: 10}
+
+	next := func(expected uint64) {
+		t.Helper()
+		nonce, err := n.Next(ctx)
+		if err != nil || nonce != expected {
+			t.Fatalf("Next() = %v, %v, expected %v", nonce, err, expected)
+		}
+	}
+
+	next(10)
+	next(11)
+	next(12)
+
+	// the last nonce is handed out again
+	n.Release(12, nil)
+	next(12)
+
+	// the gaps are handed out first, lowest first
+	tx := types.NewTx(&types.LegacyTx{Nonce: 11})
+	n.Release(11, tx)
+	n.Release(10, nil)
+	if len(n.gaps) != 2 || n.gaps[0] != 10 || n.gaps[1] != 11 {
+		t.Errorf("gaps %v, expected [10 11]", n.gaps)
+	}
+	if n.released[11] != tx.Hash() {
+		t.Errorf("released transaction of nonce 11 not recorded")
+	}
+	next(10)
+	next(11)
+	next(13)
+}
+
+func TestNonceManagerPerChain(t *testing.T) {
+
+	account := accounts.Account{Address: common.HexToAddress("0x1111111111111111111111111111111111111111")}
+	main, side := &Web3Client{Name: "main"}, &Web3Client{Name: "side"}
+
+	// clients of the same chain share the manager of the account
+	if main.nonceManager(big.NewInt(77), account) != side.nonceManager(big.NewInt(77), account) {
+		t.Errorf("clients of the same chain have different nonce managers")
+	}
+	if main.nonceManager(big.NewInt(77), account) == main.nonceManager(big.NewInt(78), account) {
+		t.Errorf("different chains share the nonce manager")
+	}
+}
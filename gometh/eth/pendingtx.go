@@ -0,0 +1,466 @@
+package eth
+
+import (
+	"context"
+	"log"
+	"sync"
+	"time"
+
+	"github.com/ethereum/go-ethereum"
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/core/types"
+)
+
+// txPollInterval is how often receipts are checked if the node does not
+// support new head subscriptions
+const txPollInterval = time.Second
+
+// TxStatus is the status of a sent transaction
+type TxStatus string
+
+const (
+	// TxPending when the transaction is in the mempool
+	TxPending TxStatus = "pending"
+	// TxReplaced when the transaction was replaced with higher fees
+	TxReplaced TxStatus = "replaced"
+	// TxMined when the transaction is in a block
+	TxMined TxStatus = "mined"
+	// TxFailed when the transaction is in a block but it failed
+	TxFailed TxStatus = "failed"
+	// TxReorged when the block of the transaction was removed by a reorg,
+	// the transaction is pending again
+	TxReorged TxStatus = "reorged"
+	// TxDropped when there is no receipt ReceiptTimeout after the last
+	// send, and it is no longer replaced
+	TxDropped TxStatus = "dropped"
+)
+
+// TxUpdate is a change of the status of a sent transaction
+type TxUpdate struct {
+	Status        TxStatus
+	Tx            *types.Transaction
+	Receipt       *types.Receipt
+	Confirmations uint64
+}
+
+// PendingTx is a sent transaction whose receipt is tracked with the new
+// heads of the chain
+type PendingTx struct {
+	client *Web3Client
+
+	mutex         sync.Mutex
+	sent          []*types.Transaction
+	mined         *types.Transaction
+	receipt       *types.Receipt
+	confirmations uint64
+	status        TxStatus
+	lastSent      time.Time
+	replacedAt    time.Time
+	replacing     bool
+	journaled     bool
+	// depth is the number of confirmations the waiters need, the
+	// transaction is tracked until it has them
+	depth       uint64
+	tracking    bool
+	changed     chan struct{}
+	subscribers []chan TxUpdate
+}
+
+func newPendingTx(client *Web3Client, tx *types.Transaction) *PendingTx {
+	now := time.Now()
+	return &PendingTx{
+		client:     client,
+		sent:       []*types.Transaction{tx},
+		status:     TxPending,
+		lastSent:   now,
+		replacedAt: now,
+		replacing:  client.ReplacePolicy.After > 0,
+		depth:      1,
+		tracking:   true,
+		changed:    make(chan struct{}),
+	}
+}
+
+// Transaction returns the mined transaction, or the last one sent if there
+// were replacements and none is mined
+func (p *PendingTx) Transaction() *types.Transaction {
+	p.mutex.Lock()
+	defer p.mutex.Unlock()
+
+	if p.mined != nil {
+		return p.mined
+	}
+	return p.sent[len(p.sent)-1]
+}
+
+// Hash returns the hash of Transaction
+func (p *PendingTx) Hash() common.Hash {
+	return p.Transaction().Hash()
+}
+
+// Status returns the current status
+func (p *PendingTx) Status() TxStatus {
+	p.mutex.Lock()
+	defer p.mutex.Unlock()
+	return p.status
+}
+
+// Receipt returns the receipt, nil if it is not mined
+func (p *PendingTx) Receipt() *types.Receipt {
+	p.mutex.Lock()
+	defer p.mutex.Unlock()
+	return p.receipt
+}
+
+// Subscribe returns a channel with the status changes, starting with the
+// current status. It is closed when the transaction is no longer tracked,
+// and updates are dropped if it is not read.
+func (p *PendingTx) Subscribe() <-chan TxUpdate {
+	p.mutex.Lock()
+	defer p.mutex.Unlock()
+
+	updates := make(chan TxUpdate, 16)
+	updates <- p.update()
+	if !p.tracking {
+		close(updates)
+		return updates
+	}
+	p.subscribers = append(p.subscribers, updates)
+	return updates
+}
+
+// Wait waits until the transaction is mined
+func (p *PendingTx) Wait(ctx context.Context) (*types.Receipt, error) {
+	return p.WaitConfirmations(ctx, 1)
+}
+
+// WaitConfirmations waits until the transaction is n blocks deep, it returns
+// ErrReceiptStatusFailed if it failed and ErrReceiptNotRecieved if dropped
+func (p *PendingTx) WaitConfirmations(ctx context.Context, n uint64) (*types.Receipt, error) {
+
+	if n == 0 {
+		n = 1
+	}
+	p.require(n)
+
+	for {
+		p.mutex.Lock()
+		status, receipt, confirmations, changed := p.status, p.receipt, p.confirmations, p.changed
+		p.mutex.Unlock()
+
+		if status == TxDropped {
+			return nil, ErrReceiptNotRecieved
+		}
+		if receipt != nil && confirmations >= n {
+			if receipt.Status == types.ReceiptStatusFailed {
+				return receipt, ErrReceiptStatusFailed
+			}
+			return receipt, nil
+		}
+
+		select {
+		case <-changed:
+		case <-ctx.Done():
+			return nil, ctx.Err()
+		}
+	}
+}
+
+// require tracks the transaction until it has n confirmations
+func (p *PendingTx) require(n uint64) {
+	p.mutex.Lock()
+	if n > p.depth {
+		p.depth = n
+	}
+	start := !p.tracking && p.status != TxDropped && p.confirmations < p.depth
+	if start {
+		p.tracking = true
+	}
+	p.mutex.Unlock()
+
+	if start {
+		p.client.track(p)
+	}
+}
+
+func (p *PendingTx) update() TxUpdate {
+	tx := p.mined
+	if tx == nil {
+		tx = p.sent[len(p.sent)-1]
+	}
+	return TxUpdate{
+		Status:        p.status,
+		Tx:            tx,
+		Receipt:       p.receipt,
+		Confirmations: p.confirmations,
+	}
+}
+
+// setStatus notifies the waiters and the subscribers and updates the
+// journal, called with the mutex held
+func (p *PendingTx) setStatus(status TxStatus) {
+	p.status = status
+
+	if p.journaled {
+		nonce := p.sent[0].Nonce()
+		switch status {
+		case TxMined:
+			p.client.journalStatus(nonce, JournalMined, p.mined, nil)
+		case TxFailed:
+			p.client.journalStatus(nonce, JournalFailed, p.mined, ErrReceiptStatusFailed)
+		case TxReplaced, TxReorged:
+			p.client.journalStatus(nonce, JournalSent, nil, nil)
+		case TxDropped:
+			p.client.journalStatus(nonce, JournalDropped, nil, ErrReceiptNotRecieved)
+		}
+	}
+
+	p.wake()
+
+	update := p.update()
+	for _, subscriber := range p.subscribers {
+		select {
+		case subscriber <- update:
+		default:
+		}
+	}
+}
+
+// wake wakes up the waiters, called with the mutex held
+func (p *PendingTx) wake() {
+	close(p.changed)
+	p.changed = make(chan struct{})
+}
+
+// finish stops tracking, it returns false if a waiter still needs more
+// confirmations
+func (p *PendingTx) finish() bool {
+	p.mutex.Lock()
+	defer p.mutex.Unlock()
+
+	if p.status != TxDropped && p.confirmations < p.depth {
+		return false
+	}
+	p.tracking = false
+	for _, subscriber := range p.subscribers {
+		close(subscriber)
+	}
+	p.subscribers = nil
+	return true
+}
+
+// check looks for the receipt at a new head, replacing the transaction if
+// it is pending for too long. It returns true when it is no longer tracked.
+func (p *PendingTx) check(ctx context.Context, head uint64) bool {
+
+	b := p.client
+
+	p.mutex.Lock()
+	sent := append([]*types.Transaction(nil), p.sent...)
+	p.mutex.Unlock()
+
+	var mined *types.Transaction
+	var receipt *types.Receipt
+	for _, tx := range sent {
+		var err error
+		receipt, err = b.conn().TransactionReceipt(ctx, tx.Hash())
+		if err != nil && err != ethereum.NotFound {
+			log.Println("[TxReceiptFailed]", b.Name, tx.Hash().Hex(), err)
+			return false
+		}
+		if receipt != nil {
+			mined = tx
+			break
+		}
+	}
+
+	p.mutex.Lock()
+	defer p.mutex.Unlock()
+
+	if receipt != nil {
+		confirmations := uint64(1)
+		if block := receipt.BlockNumber.Uint64(); head > block {
+			confirmations = head - block + 1
+		}
+		status := TxMined
+		if receipt.Status == types.ReceiptStatusFailed {
+			status = TxFailed
+		}
+		// the waiters are woken up with each confirmation, but the
+		// subscribers and the journal only see the status changes
+		switch {
+		case status != p.status || p.mined == nil || p.mined.Hash() != mined.Hash():
+			p.mined, p.receipt, p.confirmations = mined, receipt, confirmations
+			p.setStatus(status)
+		case p.receipt.BlockHash != receipt.BlockHash || p.confirmations != confirmations:
+			p.receipt, p.confirmations = receipt, confirmations
+			p.wake()
+		}
+		return p.confirmations >= p.depth
+	}
+
+	if p.receipt != nil {
+		log.Println("[TxReorged]", b.Name, p.receipt.TxHash.Hex())
+		p.mined, p.receipt, p.confirmations = nil, nil, 0
+		p.setStatus(TxReorged)
+	}
+
+	// while it is replaced it is in the mempool, or replaced by one that is
+	if !p.replacing && time.Now().Sub(p.lastSent) >= b.ReceiptTimeout {
+		p.setStatus(TxDropped)
+		return true
+	}
+
+	if p.replacing && time.Now().Sub(p.replacedAt) >= b.ReplacePolicy.After {
+		// if it fails because the nonce was mined meanwhile, the receipt
+		// is read in the next head
+		last := p.sent[len(p.sent)-1]
+		p.mutex.Unlock()
+		replacement, err := b.replaceTransaction(ctx, last, false)
+		p.mutex.Lock()
+
+		if err == nil {
+			p.sent = append(p.sent, replacement)
+			p.lastSent = time.Now()
+			p.setStatus(TxReplaced)
+		} else {
+			log.Println("[TxReplaceFailed]", b.Name, last.Hash().Hex(), err)
+			p.replacing = err != ErrReplaceFeeCeiling
+		}
+		p.replacedAt = time.Now()
+	}
+
+	return false
+}
+
+// track adds a transaction to the ones checked at each new head
+func (b *Web3Client) track(p *PendingTx) {
+	b.trackMutex.Lock()
+	defer b.trackMutex.Unlock()
+
+	if b.tracked == nil {
+		b.tracked = make(map[*PendingTx]bool)
+	}
+	b.tracked[p] = true
+	if !b.watching {
+		b.watching = true
+		go b.watchTransactions(b.context())
+	}
+}
+
+func (b *Web3Client) untrack(p *PendingTx) {
+	b.trackMutex.Lock()
+	delete(b.tracked, p)
+	b.trackMutex.Unlock()
+
+	if !p.finish() {
+		b.track(p)
+	}
+}
+
+// stopWatching returns true if there are no tracked transactions
+func (b *Web3Client) stopWatching() bool {
+	b.trackMutex.Lock()
+	defer b.trackMutex.Unlock()
+
+	if len(b.tracked) > 0 {
+		return false
+	}
+	b.watching = false
+	return true
+}
+
+func (b *Web3Client) checkTransactions(ctx context.Context, head uint64) {
+	b.trackMutex.Lock()
+	tracked := make([]*PendingTx, 0, len(b.tracked))
+	for p := range b.tracked {
+		tracked = append(tracked, p)
+	}
+	b.trackMutex.Unlock()
+
+	for _, p := range tracked {
+		if p.check(ctx, head) {
+			b.untrack(p)
+		}
+	}
+}
+
+// context returns the Context of the client, or a background one if not set
+func (b *Web3Client) context() context.Context {
+	if b.Context != nil {
+		return b.Context
+	}
+	return context.Background()
+}
+
+// endWatching stops the watcher when ctx is cancelled, the transactions
+// still tracked are watched again if tracked with a new context
+func (b *Web3Client) endWatching() {
+	b.trackMutex.Lock()
+	defer b.trackMutex.Unlock()
+	b.watching = false
+}
+
+// watchTransactions checks the tracked transactions at each new head, or
+// polling if the node does not support subscriptions, until there are none
+// or ctx is cancelled
+func (b *Web3Client) watchTransactions(ctx context.Context) {
+
+	for {
+		heads := make(chan *types.Header, 16)
+		var headerr <-chan error
+		var tick <-chan time.Time
+		var ticker *time.Ticker
+
+		sub, err := b.conn().SubscribeNewHead(ctx, heads)
+		if err == nil {
+			headerr = sub.Err()
+		} else {
+			ticker = time.NewTicker(txPollInterval)
+			tick = ticker.C
+		}
+
+		stop := func() {
+			if sub != nil {
+				sub.Unsubscribe()
+			}
+			if ticker != nil {
+				ticker.Stop()
+			}
+		}
+
+		for resubscribe := false; !resubscribe; {
+			select {
+			case <-ctx.Done():
+				stop()
+				b.endWatching()
+				return
+			case header := <-heads:
+				b.checkTransactions(ctx, header.Number.Uint64())
+			case <-tick:
+				head, err := b.conn().BlockNumber(ctx)
+				if err != nil {
+					log.Println("[TxWatcherFailed]", b.Name, err)
+					continue
+				}
+				b.checkTransactions(ctx, head)
+			case err := <-headerr:
+				log.Println("[TxWatcherFailed]", b.Name, err)
+				resubscribe = true
+			}
+
+			if b.stopWatching() {
+				stop()
+				return
+			}
+		}
+
+		stop()
+		select {
+		case <-time.After(time.Second):
+		case <-ctx.Done():
+			b.endWatching()
+			return
+		}
+	}
+}
@@ -0,0 +1,75 @@
+package eth
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/adriamb/gometh-server/gometh/store"
+
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/core/types"
+	"github.com/ethereum/go-ethereum/ethclient"
+	"github.com/ethereum/go-ethereum/rpc"
+)
+
+// pendingTestEth is a node without the receipts of the transactions
+type pendingTestEth struct{}
+
+func (s *pendingTestEth) GetTransactionReceipt(hash common.Hash) (*types.Receipt, error) {
+	return nil, nil
+}
+
+func TestPendingTxDropped(t *testing.T) {
+
+	server := rpc.NewServer()
+	if err := server.RegisterName("eth", &pendingTestEth{}); err != nil {
+		t.Fatal(err)
+	}
+	datastore, err := store.Open(t.TempDir())
+	if err != nil {
+		t.Fatal(err)
+	}
+	journal, err := NewTxJournal(datastore)
+	if err != nil {
+		t.Fatal(err)
+	}
+	b := &Web3Client{
+		Client:         ethclient.NewClient(rpc.DialInProc(server)),
+		Name:           "main",
+		Journal:        journal,
+		ReceiptTimeout: time.Minute,
+		ReplacePolicy:  ReplacePolicy{After: time.Hour},
+	}
+
+	tx := types.NewTx(&types.LegacyTx{Nonce: 1})
+	if err := b.journalSigned("redeem 01", tx); err != nil {
+		t.Fatal(err)
+	}
+
+	p := newPendingTx(b, tx)
+	p.journaled = true
+	p.lastSent = time.Now().Add(-2 * time.Minute)
+
+	// not dropped while it is being replaced
+	if p.check(context.Background(), 100) || p.Status() != TxPending {
+		t.Errorf("dropped while replacing, status %v", p.Status())
+	}
+
+	// nor before the timeout since the last send
+	p.replacing = false
+	p.lastSent = time.Now()
+	if p.check(context.Background(), 100) || p.Status() != TxPending {
+		t.Errorf("dropped before the timeout, status %v", p.Status())
+	}
+
+	p.lastSent = time.Now().Add(-2 * time.Minute)
+	if !p.check(context.Background(), 100) || p.Status() != TxDropped {
+		t.Errorf("not dropped after the timeout, status %v", p.Status())
+	}
+
+	entry, err := journal.Find("main", "redeem 01")
+	if err != nil || entry == nil || entry.Status != JournalDropped {
+		t.Errorf("journal entry %+v, %v, expected dropped", entry, err)
+	}
+}
@@ -0,0 +1,90 @@
+package eth
+
+import (
+	"fmt"
+	"log"
+	"time"
+
+	"github.com/ethereum/go-ethereum/ethclient"
+	"github.com/ethereum/go-ethereum/rpc"
+)
+
+// ConnState is the state of the connection used to receive events
+type ConnState int
+
+const (
+	// Stopped when events are not being processed
+	Stopped ConnState = iota
+	// Connected when events are being received
+	Connected
+	// Reconnecting when the connection or the subscription was lost
+	Reconnecting
+)
+
+const (
+	minReconnectBackoff = 1 * time.Second
+	maxReconnectBackoff = 2 * time.Minute
+)
+
+func (s ConnState) String() string {
+	switch s {
+	case Stopped:
+		return "Stopped"
+	case Connected:
+		return "Connected"
+	case Reconnecting:
+		return "Reconnecting"
+	}
+	return fmt.Sprintf("ConnState(%d)", int(s))
+}
+
+// State returns the state of the event connection
+func (b *Web3Client) State() ConnState {
+	b.connMutex.RLock()
+	defer b.connMutex.RUnlock()
+	return b.connState
+}
+
+func (b *Web3Client) setState(state ConnState, err error) {
+	b.connMutex.Lock()
+	changed := b.connState != state
+	b.connState = state
+	b.connMutex.Unlock()
+
+	if !changed {
+		return
+	}
+	if err != nil {
+		log.Printf("[ConnState] %v %v: %v", b.Name, state, err)
+	} else {
+		log.Printf("[ConnState] %v %v", b.Name, state)
+	}
+	if b.ConnStateHandler != nil {
+		b.ConnStateHandler(state, err)
+	}
+}
+
+// redial replaces the connection to the node by a new one
+func (b *Web3Client) redial() error {
+	rpcClient, err := rpc.Dial(b.RPCURL)
+	if err != nil {
+		return err
+	}
+
+	b.connMutex.Lock()
+	old := b.rpcClient
+	b.rpcClient = rpcClient
+	b.Client = ethclient.NewClient(rpcClient)
+	b.connMutex.Unlock()
+
+	old.Close()
+	return nil
+}
+
+func nextBackoff(backoff time.Duration) time.Duration {
+	backoff *= 2
+	if backoff > maxReconnectBackoff {
+		backoff = maxReconnectBackoff
+	}
+	return backoff
+}
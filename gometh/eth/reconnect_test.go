@@ -0,0 +1,57 @@
+package eth
+
+import (
+	"testing"
+	"time"
+)
+
+func TestNextBackoff(t *testing.T) {
+
+	backoff := minReconnectBackoff
+	for i := 0; i < 20; i++ {
+		next := nextBackoff(backoff)
+		if next > maxReconnectBackoff {
+			t.Fatalf("backoff %v over the max", next)
+		}
+		if next != 2*backoff && next != maxReconnectBackoff {
+			t.Fatalf("backoff after %v is %v", backoff, next)
+		}
+		backoff = next
+	}
+	if backoff != maxReconnectBackoff {
+		t.Errorf("backoff stays at %v", backoff)
+	}
+	if nextBackoff(time.Second) != 2*time.Second {
+		t.Errorf("backoff does not double")
+	}
+}
+
+func TestSetState(t *testing.T) {
+
+	states := []ConnState{}
+	b := &Web3Client{
+		Name: "test",
+		ConnStateHandler: func(state ConnState, err error) {
+			states = append(states, state)
+		},
+	}
+
+	// the handler is only called when the state changes
+	for _, state := range []ConnState{Connected, Connected, Reconnecting, Reconnecting, Connected, Stopped} {
+		b.setState(state, nil)
+	}
+
+	expected := []ConnState{Connected, Reconnecting, Connected, Stopped}
+	if len(states) != len(expected) {
+		t.Fatalf("states %v, expected %v", states, expected)
+	}
+	for i := range expected {
+		if states[i] != expected[i] {
+			t.Errorf("states %v, expected %v", states, expected)
+			break
+		}
+	}
+	if b.State() != Stopped {
+		t.Errorf("state is %v", b.State())
+	}
+}
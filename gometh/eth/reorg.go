@@ -0,0 +1,117 @@
+package eth
+
+import (
+	"context"
+	"log"
+
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/core/types"
+)
+
+// reorgHistory is the number of blocks that processed logs are remembered,
+// to detect if they are removed by a chain reorganization
+const reorgHistory = 256
+
+type logKey struct {
+	BlockHash common.Hash
+	Index     uint
+}
+
+func keyOf(eventlog *types.Log) logKey {
+	return logKey{eventlog.BlockHash, eventlog.Index}
+}
+
+// receiveEvent handles an unconfirmed log, it is processed as soon as it is
+// Confirmations blocks deep, or cancelled if it is removed before
+func (b *Web3Client) receiveEvent(ctx context.Context, eventlog *types.Log) {
+
+	key := keyOf(eventlog)
+
+	if eventlog.Removed {
+		if _, pending := b.pending[key]; pending {
+			delete(b.pending, key)
+			b.dropDeadLetters(eventlog)
+			log.Printf("[EventCancelled] %v block %v index %v tx %v removed by a reorg before being confirmed",
+				b.eventSignature(eventlog), eventlog.BlockNumber, eventlog.Index, eventlog.TxHash.Hex(),
+			)
+			return
+		}
+		if _, processed := b.processed[key]; processed {
+			b.reorgedAfterProcessing(eventlog)
+		}
+		return
+	}
+
+	if b.Confirmations == 0 {
+		b.dispatch(ctx, []types.Log{*eventlog})
+		return
+	}
+
+	b.pending[key] = *eventlog
+}
+
+func (b *Web3Client) receiveEvents(ctx context.Context, logs []types.Log) {
+	for i := range logs {
+		b.receiveEvent(ctx, &logs[i])
+	}
+}
+
+// confirmEvents processes, in order, the pending logs confirmed by head
+func (b *Web3Client) confirmEvents(ctx context.Context, head uint64) {
+
+	if head < b.Confirmations {
+		return
+	}
+
+	confirmed := []types.Log{}
+	for key, eventlog := range b.pending {
+		if eventlog.BlockNumber+b.Confirmations <= head {
+			confirmed = append(confirmed, eventlog)
+			delete(b.pending, key)
+		}
+	}
+
+	b.dispatch(ctx, confirmed)
+}
+
+// rememberProcessed keeps track of the processed log while it can be reorged
+func (b *Web3Client) rememberProcessed(eventlog *types.Log) {
+
+	b.processed[keyOf(eventlog)] = eventlog.BlockNumber
+
+	if eventlog.BlockNumber < reorgHistory {
+		return
+	}
+	oldest := eventlog.BlockNumber - reorgHistory
+	for key, blockno := range b.processed {
+		if blockno < oldest {
+			delete(b.processed, key)
+		}
+	}
+}
+
+// reorgedAfterProcessing reports a processed log that has been removed, and
+// rewinds the checkpoint before its block so the logs that replace it are
+// processed
+func (b *Web3Client) reorgedAfterProcessing(eventlog *types.Log) {
+
+	delete(b.processed, keyOf(eventlog))
+	b.dropDeadLetters(eventlog)
+
+	log.Println("[EventReorgedAfterProcessing] ************************************************************")
+	log.Printf("[EventReorgedAfterProcessing] %v chain, event %v", b.Name, b.eventSignature(eventlog))
+	log.Printf("[EventReorgedAfterProcessing] block %v (%v) index %v", eventlog.BlockNumber, eventlog.BlockHash.Hex(), eventlog.Index)
+	log.Printf("[EventReorgedAfterProcessing] tx %v", eventlog.TxHash.Hex())
+	log.Println("[EventReorgedAfterProcessing] was ALREADY PROCESSED and is no longer in the chain, check it manually")
+	log.Println("[EventReorgedAfterProcessing] ************************************************************")
+
+	if !b.checkpoint.IsProcessed(eventlog) {
+		return
+	}
+
+	// the whole block was replaced, and the checkpoint does not know about
+	// block hashes, so the logs of the new block at that height are only
+	// processed if the checkpoint is before it
+	b.checkpoint = &Checkpoint{Block: eventlog.BlockNumber - 1, Index: ^uint(0)}
+	b.saveCheckpoint()
+}
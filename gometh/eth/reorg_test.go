@@ -0,0 +1,88 @@
+package eth
+
+import (
+	"context"
+	"testing"
+
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/core/types"
+)
+
+// reorgTestClient returns a client that records the handled logs
+func reorgTestClient(confirmations uint64, handled *[]types.Log) (*Web3Client, types.Log) {
+	address := common.HexToAddress("0x1111111111111111111111111111111111111111")
+	topic := common.Hash{0xaa}
+	b := &Web3Client{
+		Confirmations: confirmations,
+		EventHandlers: []EventHandler{{
+			ID:      "test",
+			Address: address,
+			Topic:   topic.Hex(),
+			Handler: func(ctx context.Context, eventlog *types.Log) error {
+				*handled = append(*handled, *eventlog)
+				return nil
+			},
+		}},
+		pending:   make(map[logKey]types.Log),
+		processed: make(map[logKey]uint64),
+	}
+	return b, types.Log{Address: address, Topics: []common.Hash{topic}}
+}
+
+func TestReorgBeforeConfirmation(t *testing.T) {
+
+	handled := []types.Log{}
+	b, eventlog := reorgTestClient(2, &handled)
+	ctx := context.Background()
+
+	reorged, kept := eventlog, eventlog
+	reorged.BlockNumber, reorged.BlockHash, reorged.Index = 5, common.Hash{5}, 0
+	kept.BlockNumber, kept.BlockHash, kept.Index = 5, common.Hash{5}, 1
+
+	b.receiveEvents(ctx, []types.Log{reorged, kept})
+	b.confirmEvents(ctx, 6)
+	if len(handled) != 0 {
+		t.Fatalf("%v logs handled before being confirmed", len(handled))
+	}
+
+	reorged.Removed = true
+	b.receiveEvent(ctx, &reorged)
+	b.confirmEvents(ctx, 7)
+
+	if len(handled) != 1 || handled[0].Index != 1 {
+		t.Fatalf("handled %+v, expected only the log not removed", handled)
+	}
+	if len(b.pending) != 0 {
+		t.Errorf("%v logs still pending", len(b.pending))
+	}
+	if b.checkpoint == nil || b.checkpoint.Block != 5 || b.checkpoint.Index != 1 {
+		t.Errorf("checkpoint is %+v", b.checkpoint)
+	}
+}
+
+func TestReorgAfterProcessing(t *testing.T) {
+
+	handled := []types.Log{}
+	b, eventlog := reorgTestClient(0, &handled)
+	ctx := context.Background()
+
+	eventlog.BlockNumber, eventlog.BlockHash, eventlog.Index = 8, common.Hash{8}, 2
+	b.receiveEvent(ctx, &eventlog)
+	if len(handled) != 1 {
+		t.Fatalf("handled %v logs", len(handled))
+	}
+
+	// the log of the new block at the same height is processed
+	eventlog.Removed = true
+	b.receiveEvent(ctx, &eventlog)
+	if b.checkpoint == nil || b.checkpoint.Block != 7 {
+		t.Fatalf("checkpoint is %+v, expected before the reorged block", b.checkpoint)
+	}
+
+	replaced := eventlog
+	replaced.Removed, replaced.BlockHash, replaced.Index = false, common.Hash{9}, 0
+	b.receiveEvent(ctx, &replaced)
+	if len(handled) != 2 || handled[1].BlockHash != replaced.BlockHash {
+		t.Errorf("handled %+v, expected the log of the new block", handled)
+	}
+}
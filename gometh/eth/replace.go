@@ -0,0 +1,177 @@
+package eth
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"math/big"
+	"time"
+
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/core/types"
+)
+
+var (
+	// ErrReplaceFeeCeiling when a replacement would pay more than the ceiling
+	ErrReplaceFeeCeiling = fmt.Errorf("Replacement fees over the ceiling")
+	// ErrTxNotPending when replacing a transaction that is not in the mempool
+	ErrTxNotPending = fmt.Errorf("Transaction is not pending")
+	// ErrTxNotOwned when replacing a transaction sent by another account
+	ErrTxNotOwned = fmt.Errorf("Transaction not sent by this account")
+)
+
+// ReplacePolicy defines how stuck transactions are replaced by the same
+// nonce with higher fees
+type ReplacePolicy struct {
+	// After is the time a transaction is pending before being replaced,
+	// 0 disables the replacements
+	After time.Duration
+	// BumpPercent is how much the fees are increased in each replacement,
+	// nodes reject replacements under 10%
+	BumpPercent int64
+	// MaxFee is the max gas price, or fee cap, of a replacement, nil means
+	// no ceiling
+	MaxFee *big.Int
+}
+
+// DefaultReplacePolicy is the policy used when none is set
+var DefaultReplacePolicy = ReplacePolicy{
+	BumpPercent: 12,
+}
+
+// feesOf returns the fees paid by a transaction
+func feesOf(tx *types.Transaction) *Fees {
+	if tx.Type() == types.DynamicFeeTxType {
+		return &Fees{GasFeeCap: tx.GasFeeCap(), GasTipCap: tx.GasTipCap()}
+	}
+	return &Fees{GasPrice: tx.GasPrice()}
+}
+
+func bumpFee(fee *big.Int, percent int64) *big.Int {
+	if fee == nil {
+		return nil
+	}
+	bumped := new(big.Int).Mul(fee, big.NewInt(100+percent))
+	bumped.Div(bumped, big.NewInt(100))
+	return bumped.Add(bumped, big.NewInt(1))
+}
+
+func maxFee(a, b *big.Int) *big.Int {
+	if a == nil || (b != nil && b.Cmp(a) > 0) {
+		return b
+	}
+	return a
+}
+
+// replacementFees returns the fees of a replacement of tx, the bumped fees
+// or the current ones if they are higher
+func (b *Web3Client) replacementFees(ctx context.Context, tx *types.Transaction) (*Fees, error) {
+
+	old := feesOf(tx)
+	fees := &Fees{
+		GasPrice:  bumpFee(old.GasPrice, b.ReplacePolicy.BumpPercent),
+		GasFeeCap: bumpFee(old.GasFeeCap, b.ReplacePolicy.BumpPercent),
+		GasTipCap: bumpFee(old.GasTipCap, b.ReplacePolicy.BumpPercent),
+	}
+
+	current, err := b.Fees(ctx)
+	if err != nil {
+		return nil, err
+	}
+	if current.Dynamic() == fees.Dynamic() {
+		fees.GasPrice = maxFee(fees.GasPrice, current.GasPrice)
+		fees.GasFeeCap = maxFee(fees.GasFeeCap, current.GasFeeCap)
+		fees.GasTipCap = maxFee(fees.GasTipCap, current.GasTipCap)
+	}
+
+	if ceiling := b.ReplacePolicy.MaxFee; ceiling != nil {
+		if fees.Dynamic() && fees.GasFeeCap.Cmp(ceiling) > 0 {
+			return nil, ErrReplaceFeeCeiling
+		}
+		if !fees.Dynamic() && fees.GasPrice.Cmp(ceiling) > 0 {
+			return nil, ErrReplaceFeeCeiling
+		}
+	}
+	return fees, nil
+}
+
+// replaceTransaction sends a transaction with the nonce of tx and higher
+// fees, if cancel is set it is an empty transfer to the account itself
+func (b *Web3Client) replaceTransaction(ctx context.Context, tx *types.Transaction, cancel bool) (*types.Transaction, error) {
+
+	chainID, err := b.ChainID(ctx)
+	if err != nil {
+		return nil, err
+	}
+	fees, err := b.replacementFees(ctx, tx)
+	if err != nil {
+		return nil, err
+	}
+
+	to, value, gasLimit, data := tx.To(), tx.Value(), tx.Gas(), tx.Data()
+	if cancel {
+		to, value, gasLimit, data = &b.Account.Address, big.NewInt(0), 21000, nil
+	}
+
+	replacement := newTransaction(chainID, tx.Nonce(), to, value, gasLimit, fees, data)
+	if replacement, err = b.Signer.SignTx(replacement, chainID); err != nil {
+		return nil, err
+	}
+	if err = b.journalReplacement(replacement, cancel); err != nil {
+		return nil, err
+	}
+	err = b.conn().SendTransaction(ctx, replacement)
+	b.journalStatus(tx.Nonce(), JournalSent, nil, err)
+	if err != nil {
+		return nil, err
+	}
+
+	log.Printf("[TxReplaced] %v nonce %v %v replaced by %v %v",
+		b.Name, tx.Nonce(), tx.Hash().Hex(), replacement.Hash().Hex(), fees,
+	)
+	return replacement, nil
+}
+
+// pendingTransaction returns the pending transaction with the hash, sent
+// by the account
+func (b *Web3Client) pendingTransaction(ctx context.Context, hash common.Hash) (*types.Transaction, error) {
+
+	tx, pending, err := b.conn().TransactionByHash(ctx, hash)
+	if err != nil {
+		return nil, err
+	}
+	if !pending {
+		return nil, ErrTxNotPending
+	}
+
+	chainID, err := b.ChainID(ctx)
+	if err != nil {
+		return nil, err
+	}
+	sender, err := types.Sender(types.LatestSignerForChainID(chainID), tx)
+	if err != nil {
+		return nil, err
+	}
+	if sender != b.Account.Address {
+		return nil, ErrTxNotOwned
+	}
+	return tx, nil
+}
+
+// SpeedUp replaces a pending transaction by the same one with higher fees
+func (b *Web3Client) SpeedUp(ctx context.Context, hash common.Hash) (*types.Transaction, error) {
+	tx, err := b.pendingTransaction(ctx, hash)
+	if err != nil {
+		return nil, err
+	}
+	return b.replaceTransaction(ctx, tx, false)
+}
+
+// Cancel replaces a pending transaction by an empty one with higher fees
+func (b *Web3Client) Cancel(ctx context.Context, hash common.Hash) (*types.Transaction, error) {
+	tx, err := b.pendingTransaction(ctx, hash)
+	if err != nil {
+		return nil, err
+	}
+	return b.replaceTransaction(ctx, tx, true)
+}
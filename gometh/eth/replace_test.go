@@ -0,0 +1,98 @@
+package eth
+
+import (
+	"context"
+	"math/big"
+	"testing"
+
+	"github.com/ethereum/go-ethereum/core/types"
+	"github.com/ethereum/go-ethereum/ethclient"
+	"github.com/ethereum/go-ethereum/rpc"
+)
+
+// replaceTestEth is a node whose last block has the base fee
+type replaceTestEth struct {
+	baseFee *big.Int
+}
+
+func (s *replaceTestEth) GetBlockByNumber(number string, full bool) (*types.Header, error) {
+	return &types.Header{Number: big.NewInt(1), Difficulty: big.NewInt(0), BaseFee: s.baseFee}, nil
+}
+
+func TestReplacementFees(t *testing.T) {
+
+	dynamicTx := types.NewTx(&types.DynamicFeeTx{GasFeeCap: big.NewInt(100), GasTipCap: big.NewInt(10)})
+	legacyTx := types.NewTx(&types.LegacyTx{GasPrice: big.NewInt(100)})
+
+	tests := []struct {
+		name     string
+		tx       *types.Transaction
+		baseFee  *big.Int
+		tip      int64
+		maxFee   *big.Int
+		expected *Fees
+	}{
+		{
+			name:     "bumped",
+			tx:       dynamicTx,
+			baseFee:  big.NewInt(10),
+			tip:      2,
+			expected: &Fees{GasFeeCap: big.NewInt(113), GasTipCap: big.NewInt(12)},
+		},
+		{
+			name:     "current fees over the bumped ones",
+			tx:       dynamicTx,
+			baseFee:  big.NewInt(100),
+			tip:      20,
+			expected: &Fees{GasFeeCap: big.NewInt(220), GasTipCap: big.NewInt(20)},
+		},
+		{
+			name:    "over the ceiling",
+			tx:      dynamicTx,
+			baseFee: big.NewInt(100),
+			tip:     20,
+			maxFee:  big.NewInt(150),
+		},
+		{
+			name:     "legacy",
+			tx:       legacyTx,
+			tip:      2,
+			expected: &Fees{GasPrice: big.NewInt(113)},
+		},
+		{
+			name:   "legacy over the ceiling",
+			tx:     legacyTx,
+			tip:    2,
+			maxFee: big.NewInt(110),
+		},
+	}
+
+	for _, test := range tests {
+		server := rpc.NewServer()
+		if err := server.RegisterName("eth", &replaceTestEth{test.baseFee}); err != nil {
+			t.Fatal(err)
+		}
+		b := &Web3Client{
+			Client:        ethclient.NewClient(rpc.DialInProc(server)),
+			GasStrategy:   &FixedGasStrategy{GasTipCap: big.NewInt(test.tip)},
+			ReplacePolicy: ReplacePolicy{BumpPercent: 12, MaxFee: test.maxFee},
+		}
+
+		fees, err := b.replacementFees(context.Background(), test.tx)
+		if test.expected == nil {
+			if err != ErrReplaceFeeCeiling {
+				t.Errorf("%v: got %v, %v", test.name, fees, err)
+			}
+			continue
+		}
+		if err != nil {
+			t.Errorf("%v: %v", test.name, err)
+			continue
+		}
+		if !equalFee(fees.GasPrice, test.expected.GasPrice) ||
+			!equalFee(fees.GasFeeCap, test.expected.GasFeeCap) ||
+			!equalFee(fees.GasTipCap, test.expected.GasTipCap) {
+			t.Errorf("%v: got %v, expected %v", test.name, fees, test.expected)
+		}
+	}
+}
@@ -0,0 +1,143 @@
+package eth
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"math/big"
+	"strings"
+
+	"github.com/ethereum/go-ethereum"
+	"github.com/ethereum/go-ethereum/accounts/abi"
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/common/hexutil"
+	"github.com/ethereum/go-ethereum/core/types"
+	"github.com/ethereum/go-ethereum/rpc"
+)
+
+// RevertError is a contract call rejected by the contract, with the reason
+// decoded from the Error(string), Panic(uint256) or custom errors of the ABI
+type RevertError struct {
+	Function string
+	Reason   string
+	Data     []byte
+	// TxHash is set if the transaction was mined
+	TxHash common.Hash
+}
+
+func (e *RevertError) Error() string {
+	msg := "Function " + e.Function + " reverted"
+	if e.TxHash != (common.Hash{}) {
+		msg += " in transaction " + e.TxHash.Hex()
+	}
+	if e.Reason != "" {
+		msg += ": " + e.Reason
+	}
+	return msg
+}
+
+// revertData returns the data returned by a reverted call
+func revertData(err error) ([]byte, bool) {
+	dataErr, ok := err.(rpc.DataError)
+	if !ok {
+		return nil, false
+	}
+	data, ok := dataErr.ErrorData().(string)
+	if !ok {
+		return nil, false
+	}
+	return common.FromHex(data), true
+}
+
+// DecodeRevert returns the reason of the revert data
+func (b *Contract) DecodeRevert(data []byte) string {
+
+	if len(data) == 0 {
+		return ""
+	}
+	if reason, err := abi.UnpackRevert(data); err == nil {
+		return reason
+	}
+
+	for _, abierr := range b.Abi.Errors {
+		unpacked, err := abierr.Unpack(data)
+		if err != nil {
+			continue
+		}
+		args := []string{}
+		if values, ok := unpacked.([]interface{}); ok {
+			for _, value := range values {
+				args = append(args, fmt.Sprint(value))
+			}
+		}
+		return abierr.Name + "(" + strings.Join(args, ", ") + ")"
+	}
+
+	return hexutil.Encode(data)
+}
+
+// revertError converts the error of a call into a RevertError if the call
+// was reverted, other errors are returned as they are
+func (b *Contract) revertError(funcname string, err error) error {
+	data, ok := revertData(err)
+	if !ok {
+		if !strings.Contains(err.Error(), "execution reverted") {
+			return err
+		}
+		return &RevertError{Function: funcname}
+	}
+	return &RevertError{
+		Function: funcname,
+		Reason:   b.DecodeRevert(data),
+		Data:     data,
+	}
+}
+
+// simulate runs the transaction with eth_call, it returns a RevertError if
+// it would be rejected
+func (b *Contract) simulate(ctx context.Context, funcname string, value *big.Int, gasLimit uint64, msg []byte) error {
+
+	callmsg := ethereum.CallMsg{
+		From:  b.Client.Account.Address,
+		To:    b.Address,
+		Gas:   gasLimit,
+		Value: value,
+		Data:  msg,
+	}
+
+	_, err := b.Client.conn().CallContract(ctx, callmsg, nil)
+	if err != nil {
+		return b.revertError(funcname, err)
+	}
+	return nil
+}
+
+// traceFailure returns why a mined transaction failed, replaying it on the
+// state of the previous block
+func (b *Contract) traceFailure(ctx context.Context, funcname string, tx *types.Transaction, receipt *types.Receipt) error {
+
+	callmsg := ethereum.CallMsg{
+		From:  b.Client.Account.Address,
+		To:    tx.To(),
+		Gas:   tx.Gas(),
+		Value: tx.Value(),
+		Data:  tx.Data(),
+	}
+
+	block := new(big.Int).Sub(receipt.BlockNumber, big.NewInt(1))
+	_, err := b.Client.conn().CallContract(ctx, callmsg, block)
+
+	revert := &RevertError{Function: funcname, TxHash: tx.Hash()}
+	if err != nil {
+		if data, ok := revertData(err); ok {
+			revert.Reason, revert.Data = b.DecodeRevert(data), data
+		} else {
+			revert.Reason = err.Error()
+		}
+	} else if receipt.GasUsed == tx.Gas() {
+		revert.Reason = "out of gas"
+	} else {
+		log.Println("[TraceFailed]", funcname, tx.Hash().Hex(), "replay succeeded")
+	}
+	return revert
+}
@@ -0,0 +1,79 @@
+package eth
+
+import (
+	"errors"
+	"strings"
+	"testing"
+
+	"github.com/ethereum/go-ethereum/accounts/abi"
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/common/hexutil"
+	"github.com/ethereum/go-ethereum/crypto"
+)
+
+const revertTestAbi = `[
+	{"type":"error","name":"NotSigner","inputs":[{"name":"signer","type":"address"}]}
+]`
+
+// revertTestError is the error of a node with the data of the revert
+type revertTestError struct {
+	data interface{}
+}
+
+func (e *revertTestError) Error() string          { return "execution reverted" }
+func (e *revertTestError) ErrorCode() int         { return 3 }
+func (e *revertTestError) ErrorData() interface{} { return e.data }
+
+// revertTestData returns the data of a revert with the error
+func revertTestData(t *testing.T, signature string, argtype string, value interface{}) string {
+	typ, err := abi.NewType(argtype, "", nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	packed, err := abi.Arguments{{Type: typ}}.Pack(value)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return hexutil.Encode(append(crypto.Keccak256([]byte(signature))[:4], packed...))
+}
+
+func TestRevertError(t *testing.T) {
+
+	parsed, err := abi.JSON(strings.NewReader(revertTestAbi))
+	if err != nil {
+		t.Fatal(err)
+	}
+	contract := &Contract{Abi: parsed}
+	signer := common.HexToAddress("0x1111111111111111111111111111111111111111")
+
+	tests := []struct {
+		name   string
+		err    error
+		revert bool
+		reason string
+	}{
+		{"reason", &revertTestError{revertTestData(t, "Error(string)", "string", "already redeemed")}, true, "already redeemed"},
+		{"custom error", &revertTestError{revertTestData(t, "NotSigner(address)", "address", signer)}, true, "NotSigner(" + signer.Hex() + ")"},
+		{"unknown error", &revertTestError{"0x01020304"}, true, "0x01020304"},
+		{"without data", errors.New("execution reverted"), true, ""},
+		{"not reverted", errors.New("connection refused"), false, ""},
+	}
+
+	for _, test := range tests {
+		err := contract.revertError("unlock", test.err)
+		revert, ok := err.(*RevertError)
+		if ok != test.revert {
+			t.Errorf("%v: got %v", test.name, err)
+			continue
+		}
+		if !ok {
+			if err != test.err {
+				t.Errorf("%v: error changed to %v", test.name, err)
+			}
+			continue
+		}
+		if revert.Function != "unlock" || revert.Reason != test.reason {
+			t.Errorf("%v: got %q, expected %q", test.name, revert.Reason, test.reason)
+		}
+	}
+}
@@ -0,0 +1,144 @@
+package eth
+
+import (
+	"crypto/ecdsa"
+	"fmt"
+	"io/ioutil"
+	"math/big"
+
+	"github.com/ethereum/go-ethereum/accounts"
+	"github.com/ethereum/go-ethereum/accounts/external"
+	"github.com/ethereum/go-ethereum/accounts/keystore"
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/core/types"
+	"github.com/ethereum/go-ethereum/crypto"
+)
+
+var (
+	// ErrSignerAccountNotFound when the signer does not have the account
+	ErrSignerAccountNotFound = fmt.Errorf("Account not found in signer")
+)
+
+// Signer signs the transactions and messages of an account
+type Signer interface {
+	// Account is the account used to sign
+	Account() accounts.Account
+	// SignText signs the hash of the text with the ethereum message prefix,
+	// the signature is in the [R || S || V] format where V is 0 or 1
+	SignText(text []byte) ([]byte, error)
+	// SignTx signs a transaction for the chain
+	SignTx(tx *types.Transaction, chainID *big.Int) (*types.Transaction, error)
+}
+
+// KeystoreSigner signs with an unlocked account of a geth keystore
+type KeystoreSigner struct {
+	Ks      *keystore.KeyStore
+	account accounts.Account
+}
+
+// NewKeystoreSigner creates a signer for an account of the keystore, the
+// account has to be unlocked
+func NewKeystoreSigner(ks *keystore.KeyStore, account accounts.Account) *KeystoreSigner {
+	return &KeystoreSigner{Ks: ks, account: account}
+}
+
+// Account is the account used to sign
+func (s *KeystoreSigner) Account() accounts.Account {
+	return s.account
+}
+
+// SignText signs the text with the ethereum message prefix
+func (s *KeystoreSigner) SignText(text []byte) ([]byte, error) {
+	return s.Ks.SignHash(s.account, accounts.TextHash(text))
+}
+
+// SignTx signs a transaction for the chain
+func (s *KeystoreSigner) SignTx(tx *types.Transaction, chainID *big.Int) (*types.Transaction, error) {
+	return s.Ks.SignTx(s.account, tx, chainID)
+}
+
+// KeyFileSigner signs with the key of an encrypted key file
+type KeyFileSigner struct {
+	account accounts.Account
+	key     *ecdsa.PrivateKey
+}
+
+// NewKeyFileSigner decrypts the key file, in the keystore json format
+func NewKeyFileSigner(path string, passwd string) (*KeyFileSigner, error) {
+	keyjson, err := ioutil.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	key, err := keystore.DecryptKey(keyjson, passwd)
+	if err != nil {
+		return nil, fmt.Errorf("Cannot decrypt key file %v: %v", path, err)
+	}
+	return &KeyFileSigner{
+		account: accounts.Account{
+			Address: key.Address,
+			URL:     accounts.URL{Scheme: keystore.KeyStoreScheme, Path: path},
+		},
+		key: key.PrivateKey,
+	}, nil
+}
+
+// Account is the account used to sign
+func (s *KeyFileSigner) Account() accounts.Account {
+	return s.account
+}
+
+// SignText signs the text with the ethereum message prefix
+func (s *KeyFileSigner) SignText(text []byte) ([]byte, error) {
+	return crypto.Sign(accounts.TextHash(text), s.key)
+}
+
+// SignTx signs a transaction for the chain
+func (s *KeyFileSigner) SignTx(tx *types.Transaction, chainID *big.Int) (*types.Transaction, error) {
+	return types.SignTx(tx, types.LatestSignerForChainID(chainID), s.key)
+}
+
+// ExternalSigner signs with an external signer, like clef, through its
+// json-rpc api over http or ipc, so the keys are not in this process
+type ExternalSigner struct {
+	signer  *external.ExternalSigner
+	account accounts.Account
+}
+
+// NewExternalSigner connects to the signer at endpoint, an url or an ipc
+// path. If address is zero the signer must have only one account.
+func NewExternalSigner(endpoint string, address common.Address) (*ExternalSigner, error) {
+
+	signer, err := external.NewExternalSigner(endpoint)
+	if err != nil {
+		return nil, err
+	}
+
+	signerAccounts := signer.Accounts()
+	if address == (common.Address{}) {
+		if len(signerAccounts) != 1 {
+			return nil, fmt.Errorf("Not exact one account in external signer, was %v", len(signerAccounts))
+		}
+		return &ExternalSigner{signer, signerAccounts[0]}, nil
+	}
+	for _, account := range signerAccounts {
+		if account.Address == address {
+			return &ExternalSigner{signer, account}, nil
+		}
+	}
+	return nil, ErrSignerAccountNotFound
+}
+
+// Account is the account used to sign
+func (s *ExternalSigner) Account() accounts.Account {
+	return s.account
+}
+
+// SignText asks the external signer to sign the text
+func (s *ExternalSigner) SignText(text []byte) ([]byte, error) {
+	return s.signer.SignText(s.account, text)
+}
+
+// SignTx asks the external signer to sign the transaction
+func (s *ExternalSigner) SignTx(tx *types.Transaction, chainID *big.Int) (*types.Transaction, error) {
+	return s.signer.SignTx(s.account, tx, chainID)
+}
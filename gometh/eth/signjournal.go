@@ -0,0 +1,178 @@
+package eth
+
+import (
+	"context"
+	"encoding/hex"
+	"log"
+	"math/big"
+	"time"
+
+	"github.com/adriamb/gometh-server/gometh/store"
+
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/common/math"
+	"github.com/ethereum/go-ethereum/core/types"
+	"github.com/ethereum/go-ethereum/crypto"
+)
+
+// SigningStatus is the outcome of a partial execution sent by this validator
+type SigningStatus string
+
+const (
+	// SigningPending when the transaction is being sent
+	SigningPending SigningStatus = "pending"
+	// SigningConfirmed when the transaction was mined successfully
+	SigningConfirmed SigningStatus = "confirmed"
+	// SigningFailed when the transaction failed, it can be sent again
+	SigningFailed SigningStatus = "failed"
+	// SigningOnChain when the signature was found in the contract
+	SigningOnChain SigningStatus = "onchain"
+)
+
+// SigningEntry records a partial execution of a txid by this validator
+type SigningEntry struct {
+	TxID     string
+	Function string
+	Status   SigningStatus
+	TxHash   string
+	Error    string
+	Updated  time.Time
+}
+
+// SigningJournal records the txids this validator has partially executed,
+// so they are not sent again when events are replayed
+type SigningJournal struct {
+	store *store.Store
+}
+
+// NewSigningJournal creates a signing journal on top of a store
+func NewSigningJournal(s *store.Store) (*SigningJournal, error) {
+	bucket, err := s.Bucket("signings")
+	if err != nil {
+		return nil, err
+	}
+	return &SigningJournal{bucket}, nil
+}
+
+// Get returns the entry of the txid, or nil if there is none
+func (j *SigningJournal) Get(txid [32]byte) (*SigningEntry, error) {
+	var entry SigningEntry
+	err := j.store.Get(hex.EncodeToString(txid[:]), &entry)
+	if err == store.ErrNotFound {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	return &entry, nil
+}
+
+// Record saves the status of the txid
+func (j *SigningJournal) Record(txid [32]byte, function string, status SigningStatus, txhash common.Hash, err error) error {
+	entry := SigningEntry{
+		TxID:     hex.EncodeToString(txid[:]),
+		Function: function,
+		Status:   status,
+		Updated:  time.Now(),
+	}
+	if txhash != (common.Hash{}) {
+		entry.TxHash = txhash.Hex()
+	}
+	if err != nil {
+		entry.Error = err.Error()
+	}
+	return j.store.Put(entry.TxID, &entry)
+}
+
+// recoverSigner returns the address that produced the {v,r,s} signature
+// created by sign
+func recoverSigner(sig [3][32]byte, data ...[]byte) (common.Address, error) {
+	web3SignaturePrefix := []byte("\x19Ethereum Signed Message:\n32")
+
+	hash := crypto.Keccak256(data...)
+	prefixedHash := crypto.Keccak256(web3SignaturePrefix, hash)
+
+	rsv := make([]byte, 65)
+	copy(rsv[0:32], sig[1][:])
+	copy(rsv[32:64], sig[2][:])
+	rsv[64] = sig[0][31] - 27
+
+	pubkey, err := crypto.SigToPub(prefixedHash, rsv)
+	if err != nil {
+		return common.Address{}, err
+	}
+	return crypto.PubkeyToAddress(*pubkey), nil
+}
+
+// SignedOnChain returns true if the contract already has the signature of
+// this validator for the txid
+func (b *Contract) SignedOnChain(ctx context.Context, txid [32]byte) (bool, error) {
+
+	type GetSignatures struct {
+		Epoch *big.Int
+		Data  []byte
+		Sigs  [][32]byte
+	}
+
+	var output GetSignatures
+	if err := b.Call(ctx, &output, "getSignatures", txid); err != nil {
+		return false, err
+	}
+	if output.Epoch == nil {
+		output.Epoch = big.NewInt(0)
+	}
+
+	// signatures are stored as consecutive {v,r,s} words
+	for i := 0; i+2 < len(output.Sigs); i += 3 {
+		sig := [3][32]byte{output.Sigs[i], output.Sigs[i+1], output.Sigs[i+2]}
+		signer, err := recoverSigner(sig, math.U256Bytes(output.Epoch), txid[:], output.Data)
+		if err != nil {
+			continue
+		}
+		if signer == b.bridgeSigner().Account().Address {
+			return true, nil
+		}
+	}
+	return false, nil
+}
+
+// alreadySigned returns true if this validator already sent the partial
+// execution of txid, checking the journal and, if onchain, the contract
+func (b *Contract) alreadySigned(ctx context.Context, txid [32]byte, funcname string, onchain bool) (bool, error) {
+
+	if b.Signings != nil {
+		entry, err := b.Signings.Get(txid)
+		if err != nil {
+			return false, err
+		}
+		if entry != nil && (entry.Status == SigningConfirmed || entry.Status == SigningOnChain) {
+			return true, nil
+		}
+	}
+
+	if onchain {
+		signed, err := b.SignedOnChain(ctx, txid)
+		if err != nil {
+			return false, err
+		}
+		if signed {
+			b.recordSigning(txid, funcname, SigningOnChain, nil, nil)
+			return true, nil
+		}
+	}
+
+	return false, nil
+}
+
+func (b *Contract) recordSigning(txid [32]byte, funcname string, status SigningStatus, tx *types.Transaction, err error) {
+	if b.Signings == nil {
+		return
+	}
+	var txhash common.Hash
+	if tx != nil {
+		txhash = tx.Hash()
+	}
+	if err := b.Signings.Record(txid, funcname, status, txhash, err); err != nil {
+		log.Println("[SigningJournalFailed]", hex.EncodeToString(txid[:]), err)
+	}
+}
@@ -0,0 +1,395 @@
+package eth
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/adriamb/gometh-server/gometh/store"
+
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/common/hexutil"
+	"github.com/ethereum/go-ethereum/core/types"
+	"github.com/ethereum/go-ethereum/crypto"
+)
+
+// JournalStatus is the status of an outbound transaction
+type JournalStatus string
+
+const (
+	// JournalSigned when the transaction is signed, before it is sent
+	JournalSigned JournalStatus = "signed"
+	// JournalSent when the transaction was accepted by the node
+	JournalSent JournalStatus = "sent"
+	// JournalMined when the transaction was mined successfully
+	JournalMined JournalStatus = "mined"
+	// JournalFailed when the transaction was mined but failed
+	JournalFailed JournalStatus = "failed"
+	// JournalCancelled when a cancellation of the transaction was mined
+	JournalCancelled JournalStatus = "cancelled"
+	// JournalAborted when the node rejected the transaction
+	JournalAborted JournalStatus = "aborted"
+	// JournalDropped when the nonce was used by a transaction not journaled,
+	// or there was no receipt after the ReceiptTimeout
+	JournalDropped JournalStatus = "dropped"
+)
+
+// InFlight returns true if the transaction may still be mined
+func (s JournalStatus) InFlight() bool {
+	return s == JournalSigned || s == JournalSent
+}
+
+// JournalEntry is an outbound transaction, one per account nonce. Hashes and
+// RawTxs have the transaction and its replacements.
+type JournalEntry struct {
+	ID         string
+	Chain      string
+	Account    string
+	Nonce      uint64
+	Intent     string
+	Hashes     []string
+	RawTxs     []string
+	CancelHash string
+	MinedHash  string
+	Status     JournalStatus
+	Error      string
+	Created    time.Time
+	Updated    time.Time
+}
+
+// TxJournal is a write-ahead journal of the outbound transactions, written
+// before they are sent so they can be reconciled after a crash
+type TxJournal struct {
+	store *store.Store
+	// intents has the id of the last entry of each intent
+	intents *store.Store
+	// mutex serializes the updates of the entries
+	mutex sync.Mutex
+}
+
+// NewTxJournal creates a transaction journal on top of a store
+func NewTxJournal(s *store.Store) (*TxJournal, error) {
+	bucket, err := s.Bucket("transactions")
+	if err != nil {
+		return nil, err
+	}
+	intents, err := s.Bucket("intents")
+	if err != nil {
+		return nil, err
+	}
+	journal := &TxJournal{store: bucket, intents: intents}
+	if err := journal.reindex(); err != nil {
+		return nil, err
+	}
+	return journal, nil
+}
+
+func journalID(chain string, account common.Address, nonce uint64) string {
+	return fmt.Sprintf("%v-%v-%010d", chain, strings.ToLower(account.Hex()), nonce)
+}
+
+// intentKey is the key of the intent in the index, intents are free text
+func intentKey(chain string, intent string) string {
+	return chain + "-" + hexutil.Encode(crypto.Keccak256([]byte(intent)))[2:]
+}
+
+// reindex builds the intent index of a journal written without it
+func (j *TxJournal) reindex() error {
+	indexed, err := j.intents.Keys()
+	if err != nil || len(indexed) > 0 {
+		return err
+	}
+	entries, err := j.List()
+	if err != nil {
+		return err
+	}
+	last := make(map[string]*JournalEntry)
+	for _, entry := range entries {
+		if entry.Intent == "" {
+			continue
+		}
+		key := intentKey(entry.Chain, entry.Intent)
+		if found, ok := last[key]; !ok || entry.Created.After(found.Created) {
+			last[key] = entry
+		}
+	}
+	for key, entry := range last {
+		if err := j.intents.Put(key, entry.ID); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// Get returns the entry with the id
+func (j *TxJournal) Get(id string) (*JournalEntry, error) {
+	var entry JournalEntry
+	if err := j.store.Get(id, &entry); err != nil {
+		return nil, err
+	}
+	return &entry, nil
+}
+
+// Put saves the entry, and indexes its intent
+func (j *TxJournal) Put(entry *JournalEntry) error {
+	entry.Updated = time.Now()
+	if err := j.store.Put(entry.ID, entry); err != nil {
+		return err
+	}
+	if entry.Intent == "" {
+		return nil
+	}
+	return j.intents.Put(intentKey(entry.Chain, entry.Intent), entry.ID)
+}
+
+// List returns all the entries, ordered by chain, account and nonce
+func (j *TxJournal) List() ([]*JournalEntry, error) {
+	ids, err := j.store.Keys()
+	if err != nil {
+		return nil, err
+	}
+	entries := []*JournalEntry{}
+	for _, id := range ids {
+		entry, err := j.Get(id)
+		if err != nil {
+			return nil, err
+		}
+		entries = append(entries, entry)
+	}
+	return entries, nil
+}
+
+// Find returns the last entry of the intent in the chain, nil if none
+func (j *TxJournal) Find(chain string, intent string) (*JournalEntry, error) {
+	var id string
+	err := j.intents.Get(intentKey(chain, intent), &id)
+	if err == store.ErrNotFound {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	entry, err := j.Get(id)
+	if err == store.ErrNotFound {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	// the nonce may have been reused by another intent
+	if entry.Intent != intent {
+		return nil, nil
+	}
+	return entry, nil
+}
+
+// transactions returns the signed transactions of the entry
+func (e *JournalEntry) transactions() ([]*types.Transaction, error) {
+	txs := []*types.Transaction{}
+	for _, raw := range e.RawTxs {
+		data, err := hexutil.Decode(raw)
+		if err != nil {
+			return nil, err
+		}
+		tx := new(types.Transaction)
+		if err := tx.UnmarshalBinary(data); err != nil {
+			return nil, err
+		}
+		txs = append(txs, tx)
+	}
+	return txs, nil
+}
+
+// journalSigned records a new signed transaction before it is sent, in a
+// new entry even if the nonce was used by an aborted one
+func (b *Web3Client) journalSigned(intent string, tx *types.Transaction) error {
+	return b.journalTx(intent, tx, false, false)
+}
+
+// journalReplacement records a replacement before it is sent, in the entry
+// of the transaction it replaces, cancel marks replacements that cancel it
+func (b *Web3Client) journalReplacement(tx *types.Transaction, cancel bool) error {
+	return b.journalTx("", tx, true, cancel)
+}
+
+func (b *Web3Client) journalTx(intent string, tx *types.Transaction, replacement bool, cancel bool) error {
+
+	if b.Journal == nil {
+		return nil
+	}
+
+	raw, err := tx.MarshalBinary()
+	if err != nil {
+		return err
+	}
+
+	b.Journal.mutex.Lock()
+	defer b.Journal.mutex.Unlock()
+
+	id := journalID(b.Name, b.Account.Address, tx.Nonce())
+	entry, err := b.Journal.Get(id)
+	if err == store.ErrNotFound || (err == nil && !replacement) {
+		entry = &JournalEntry{
+			ID:      id,
+			Chain:   b.Name,
+			Account: b.Account.Address.Hex(),
+			Nonce:   tx.Nonce(),
+			Intent:  intent,
+			Created: time.Now(),
+		}
+	} else if err != nil {
+		return err
+	}
+
+	entry.Hashes = append(entry.Hashes, tx.Hash().Hex())
+	entry.RawTxs = append(entry.RawTxs, hexutil.Encode(raw))
+	if cancel {
+		entry.CancelHash = tx.Hash().Hex()
+	}
+	entry.Status = JournalSigned
+	entry.Error = ""
+
+	return b.Journal.Put(entry)
+}
+
+// journalStatus updates the status of the entry of the nonce, mined is the
+// transaction mined if any
+func (b *Web3Client) journalStatus(nonce uint64, status JournalStatus, mined *types.Transaction, err error) {
+
+	if b.Journal == nil {
+		return
+	}
+
+	b.Journal.mutex.Lock()
+	defer b.Journal.mutex.Unlock()
+
+	id := journalID(b.Name, b.Account.Address, nonce)
+	entry, geterr := b.Journal.Get(id)
+	if geterr != nil {
+		log.Println("[TxJournalFailed]", id, geterr)
+		return
+	}
+
+	entry.Status = status
+	entry.MinedHash = ""
+	if mined != nil {
+		entry.MinedHash = mined.Hash().Hex()
+		if status == JournalMined && entry.MinedHash == entry.CancelHash {
+			entry.Status = JournalCancelled
+		}
+	}
+	if err != nil {
+		entry.Error = err.Error()
+	}
+
+	if puterr := b.Journal.Put(entry); puterr != nil {
+		log.Println("[TxJournalFailed]", id, puterr)
+	}
+}
+
+// resume tracks again the transactions of an in-flight entry, sending
+// again the last one if the node does not have it
+func (b *Web3Client) resume(ctx context.Context, entry *JournalEntry) (*PendingTx, error) {
+
+	txs, err := entry.transactions()
+	if err != nil {
+		return nil, err
+	}
+	if len(txs) == 0 {
+		return nil, fmt.Errorf("Journal entry %v has no transactions", entry.ID)
+	}
+
+	// mined while the process was down
+	for _, tx := range txs {
+		receipt, _ := b.conn().TransactionReceipt(ctx, tx.Hash())
+		if receipt == nil {
+			continue
+		}
+		status := JournalMined
+		if receipt.Status == types.ReceiptStatusFailed {
+			status = JournalFailed
+		}
+		b.journalStatus(entry.Nonce, status, tx, nil)
+		pending := newPendingTx(b, tx)
+		pending.journaled = true
+		b.track(pending)
+		return pending, nil
+	}
+
+	nonce, err := b.conn().NonceAt(ctx, b.Account.Address, nil)
+	if err != nil {
+		return nil, err
+	}
+	if nonce > entry.Nonce {
+		b.journalStatus(entry.Nonce, JournalDropped, nil, nil)
+		return nil, fmt.Errorf("Nonce %v of %v was used by another transaction", entry.Nonce, entry.Account)
+	}
+
+	last := txs[len(txs)-1]
+	if err := b.conn().SendTransaction(ctx, last); err != nil && !isKnownTransaction(err) {
+		return nil, err
+	}
+	b.journalStatus(entry.Nonce, JournalSent, nil, nil)
+
+	pending := newPendingTx(b, txs[0])
+	pending.sent = txs
+	pending.journaled = true
+	b.track(pending)
+	return pending, nil
+}
+
+// Resume returns the pending transaction of the last entry of the intent,
+// nil if there is none in flight
+func (b *Web3Client) Resume(ctx context.Context, intent string) (*PendingTx, *JournalEntry, error) {
+
+	if b.Journal == nil {
+		return nil, nil, nil
+	}
+	entry, err := b.Journal.Find(b.Name, intent)
+	if err != nil || entry == nil {
+		return nil, entry, err
+	}
+	if !entry.Status.InFlight() {
+		return nil, entry, nil
+	}
+	pending, err := b.resume(ctx, entry)
+	return pending, entry, err
+}
+
+// ReconcileJournal checks the in-flight transactions of the journal against
+// the chain, they are marked as mined or dropped, or sent again and tracked
+func (b *Web3Client) ReconcileJournal(ctx context.Context) error {
+
+	if b.Journal == nil {
+		return nil
+	}
+
+	entries, err := b.Journal.List()
+	if err != nil {
+		return err
+	}
+
+	for _, entry := range entries {
+		if entry.Chain != b.Name || entry.Account != b.Account.Address.Hex() || !entry.Status.InFlight() {
+			continue
+		}
+		pending, err := b.resume(ctx, entry)
+		if err != nil {
+			log.Println("[TxJournalReconcile]", entry.ID, entry.Intent, err)
+			continue
+		}
+		log.Println("[TxJournalReconcile]", entry.ID, entry.Intent, pending.Hash().Hex(), pending.Status())
+	}
+
+	return nil
+}
+
+// isKnownTransaction returns true if the node already has the transaction,
+// or another one with the same nonce and higher fees
+func isKnownTransaction(err error) bool {
+	return isAlreadyKnown(err) ||
+		strings.Contains(strings.ToLower(err.Error()), "replacement transaction underpriced")
+}
@@ -0,0 +1,115 @@
+package eth
+
+import (
+	"math/big"
+	"testing"
+	"time"
+
+	"github.com/adriamb/gometh-server/gometh/store"
+
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/core/types"
+)
+
+func TestTxJournalFind(t *testing.T) {
+
+	datastore, err := store.Open(t.TempDir())
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// entries written before the intent index existed
+	transactions, err := datastore.Bucket("transactions")
+	if err != nil {
+		t.Fatal(err)
+	}
+	now := time.Now()
+	for _, entry := range []*JournalEntry{
+		{ID: "main-0x01-0000000001", Chain: "main", Intent: "redeem 01", Created: now},
+		{ID: "main-0x01-0000000002", Chain: "main", Intent: "redeem 01", Created: now.Add(time.Second)},
+		{ID: "side-0x01-0000000001", Chain: "side", Intent: "redeem 01", Created: now},
+	} {
+		if err := transactions.Put(entry.ID, entry); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	journal, err := NewTxJournal(datastore)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	find := func(chain, intent string) string {
+		entry, err := journal.Find(chain, intent)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if entry == nil {
+			return ""
+		}
+		return entry.ID
+	}
+
+	if id := find("main", "redeem 01"); id != "main-0x01-0000000002" {
+		t.Errorf("reindexed main intent found %q", id)
+	}
+	if id := find("side", "redeem 01"); id != "side-0x01-0000000001" {
+		t.Errorf("reindexed side intent found %q", id)
+	}
+	if id := find("main", "redeem 02"); id != "" {
+		t.Errorf("unknown intent found %q", id)
+	}
+
+	// a nonce reused by another intent
+	if err := journal.Put(&JournalEntry{ID: "side-0x01-0000000001", Chain: "side", Intent: "redeem 02"}); err != nil {
+		t.Fatal(err)
+	}
+	if id := find("side", "redeem 01"); id != "" {
+		t.Errorf("overwritten intent found %q", id)
+	}
+	if id := find("side", "redeem 02"); id != "side-0x01-0000000001" {
+		t.Errorf("new intent found %q", id)
+	}
+}
+
+func TestJournalSignedNewEntry(t *testing.T) {
+
+	datastore, err := store.Open(t.TempDir())
+	if err != nil {
+		t.Fatal(err)
+	}
+	journal, err := NewTxJournal(datastore)
+	if err != nil {
+		t.Fatal(err)
+	}
+	b := &Web3Client{Name: "main", Journal: journal}
+	b.Account.Address = common.HexToAddress("0x1111111111111111111111111111111111111111")
+
+	tx := func(price int64) *types.Transaction {
+		return types.NewTx(&types.LegacyTx{Nonce: 1, GasPrice: big.NewInt(price), Gas: 21000})
+	}
+
+	if err := b.journalSigned("redeem 01", tx(1)); err != nil {
+		t.Fatal(err)
+	}
+	b.journalStatus(1, JournalAborted, nil, nil)
+
+	// an unrelated transaction at the same nonce starts a new entry
+	if err := b.journalSigned("", tx(2)); err != nil {
+		t.Fatal(err)
+	}
+	if err := b.journalReplacement(tx(3), false); err != nil {
+		t.Fatal(err)
+	}
+
+	entry, err := journal.Get(journalID("main", b.Account.Address, 1))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if entry.Intent != "" || len(entry.Hashes) != 2 || entry.Hashes[0] != tx(2).Hash().Hex() || entry.Hashes[1] != tx(3).Hash().Hex() {
+		t.Errorf("entry %+v, expected the new transaction and its replacement", entry)
+	}
+	if found, err := journal.Find("main", "redeem 01"); err != nil || found != nil {
+		t.Errorf("aborted intent found %+v, %v", found, err)
+	}
+}
@@ -3,8 +3,10 @@ package eth
 import (
 	"context"
 	"encoding/hex"
+	"encoding/json"
 	"log"
 	"math/big"
+	"strings"
 	"sync"
 	"time"
 
@@ -12,10 +14,10 @@ import (
 
 	"github.com/ethereum/go-ethereum"
 	"github.com/ethereum/go-ethereum/accounts"
-	"github.com/ethereum/go-ethereum/accounts/keystore"
 	"github.com/ethereum/go-ethereum/common"
 	"github.com/ethereum/go-ethereum/core/types"
 	"github.com/ethereum/go-ethereum/ethclient"
+	"github.com/ethereum/go-ethereum/rpc"
 
 	"fmt"
 )
@@ -27,51 +29,129 @@ var (
 	ErrReceiptNotRecieved = fmt.Errorf("ErrReceiptNotRecieved")
 )
 
-type EventHandlerFunc func(*types.Log) error
+type EventHandlerFunc func(ctx context.Context, eventlog *types.Log) error
 
 // EventHandler associates a function to an event
 type EventHandler struct {
+	// ID identifies the handler in the dead letters, it does not depend on
+	// the order the handlers are registered
+	ID             string
 	Address        common.Address
 	EventSignature string
 	Topic          string
 	Handler        EventHandlerFunc
 }
 
-// Web3Client defines a connection to a client via websockets
+// Web3Client defines a connection to a client via websockets or http
 type Web3Client struct {
-	ClientMutex    *sync.Mutex
 	Client         *ethclient.Client
+	RPCURL         string
 	Account        accounts.Account
-	Ks             *keystore.KeyStore
+	Signer         Signer
 	ReceiptTimeout time.Duration
-	EventHandlers  []EventHandler
+
+	// TxType selects legacy or dynamic fee transactions, by default dynamic
+	// fee transactions are used if the chain supports them
+	TxType TxType
+	// GasStrategy computes the fees, by default the node oracle is used
+	GasStrategy GasStrategy
+	// GasCaps are the max fees paid
+	GasCaps GasCaps
+	// ReplacePolicy defines how the transactions stuck in the mempool are
+	// replaced while waiting for their receipt
+	ReplacePolicy ReplacePolicy
+
+	EventHandlers []EventHandler
+	Middlewares   []EventMiddleware
+
+	// Name identifies the chain in the checkpoint store
+	Name string
+	// Checkpoints, if set, persists the last processed log so HandleEvents
+	// resumes from there, if not set only new events are processed. The
+	// checkpoint is kept by Name, chain id and the contract of the first
+	// event handler.
+	Checkpoints *CheckpointStore
+	// StartBlock is where events are processed from if there is no checkpoint
+	StartBlock uint64
+	// BlockWindow is the max number of blocks requested per FilterLogs call
+	BlockWindow uint64
+	// Confirmations is the number of blocks a log must be deep to be processed
+	Confirmations uint64
+	// PollInterval, if set, polls the node for new logs instead of subscribing
+	PollInterval time.Duration
+	// EventWorkers is the max number of transactions of a block whose events
+	// are handled concurrently, 0 or 1 handles all events sequentially
+	EventWorkers int
+
+	// DeadLetters, if set, stores the events whose handler failed to be retried
+	DeadLetters *DeadLetterStore
+	// RetryPolicy defines how the failed events are retried
+	RetryPolicy RetryPolicy
+	// RetryInterval is how often the failed events are checked for retry
+	RetryInterval time.Duration
+
+	// Journal, if set, records the outbound transactions before sending them
+	Journal *TxJournal
+
+	// Context, if set, stops watching the sent transactions when cancelled
+	Context context.Context
+
+	// ConnStateHandler, if set, is called when the connection state changes
+	ConnStateHandler func(state ConnState, err error)
+
+	tracked      map[*PendingTx]bool
+	trackMutex   sync.Mutex
+	watching     bool
+	chainID      *big.Int
+	rpcClient    *rpc.Client
+	connMutex    sync.RWMutex
+	connState    ConnState
+	scanFrom     uint64
+	checkpoint   *Checkpoint
+	checkpointID string
+	pending      map[logKey]types.Log
+	processed    map[logKey]uint64
+	// handleMutex serializes the dispatched events and the dead letter retries
+	handleMutex sync.Mutex
 }
 
-// NewWeb3Client creates a client, using a keystore and an account for transactions
-func NewWeb3Client(rpcURL string, ks *keystore.KeyStore, account accounts.Account) (*Web3Client, error) {
+// NewWeb3Client creates a client, using the account of the signer for transactions
+func NewWeb3Client(rpcURL string, signer Signer) (*Web3Client, error) {
 
 	var err error
 
-	client, err := ethclient.Dial(rpcURL)
+	rpcClient, err := rpc.Dial(rpcURL)
 	if err != nil {
 		return nil, err
 	}
 
 	return &Web3Client{
-		Client:         client,
-		Ks:             ks,
-		Account:        account,
+		Client:         ethclient.NewClient(rpcClient),
+		rpcClient:      rpcClient,
+		RPCURL:         rpcURL,
+		Signer:         signer,
+		Account:        signer.Account(),
 		ReceiptTimeout: 120 * time.Second,
+		TxType:         TxTypeAuto,
+		ReplacePolicy:  DefaultReplacePolicy,
 		EventHandlers:  []EventHandler{},
+		BlockWindow:    1000,
+		RetryPolicy:    DefaultRetryPolicy,
+		RetryInterval:  10 * time.Second,
 	}, nil
 }
 
+func (b *Web3Client) conn() *ethclient.Client {
+	b.connMutex.RLock()
+	defer b.connMutex.RUnlock()
+	return b.Client
+}
+
 // AccountInfo retieves information about the default account
-func (b *Web3Client) AccountInfo() (string, error) {
+func (b *Web3Client) AccountInfo(ctx context.Context) (string, error) {
 
 	address := b.Account.Address.Hex()
-	ctx := context.TODO()
-	balance, err := b.Client.BalanceAt(ctx, b.Account.Address, nil)
+	balance, err := b.conn().BalanceAt(ctx, b.Account.Address, nil)
 	if err != nil {
 
 		return "", err
@@ -79,26 +159,70 @@ func (b *Web3Client) AccountInfo() (string, error) {
 	return address + "=" + balance.String() + " wei", nil
 }
 
-// SendTransactionSync executes a contract method and wait it finalizes
-func (b *Web3Client) SendTransactionSync(to *common.Address, value *big.Int, gasLimit uint64, calldata []byte) (*types.Transaction, *types.Receipt, error) {
+// sendTransaction signs, journals and sends the transaction built with the
+// nonce given by the nonce manager of the account
+func (b *Web3Client) sendTransaction(ctx context.Context, chainID *big.Int, intent string, build func(nonce uint64) *types.Transaction) (*types.Transaction, error) {
 
-	b.ClientMutex.Lock()
-	defer b.ClientMutex.Unlock()
+	nonces := b.nonceManager(chainID, b.Account)
 
-	var err error
-	var tx *types.Transaction
-	var receipt *types.Receipt
+	for attempt := 0; ; attempt++ {
+		nonce, err := nonces.Next(ctx)
+		if err != nil {
+			return nil, err
+		}
+
+		tx, err := b.Signer.SignTx(build(nonce), chainID)
+		if err != nil {
+			nonces.Release(nonce, nil)
+			return nil, err
+		}
+
+		if err = b.journalSigned(intent, tx); err != nil {
+			nonces.Release(nonce, nil)
+			return nil, err
+		}
+
+		if cfg.Verbose > 0 {
+			log.Println(dumpJSON(tx))
+		}
+
+		// the node may have the transaction if it was sent before a timeout
+		if err = b.conn().SendTransaction(ctx, tx); err == nil || isAlreadyKnown(err) {
+			b.journalStatus(nonce, JournalSent, nil, nil)
+			return tx, nil
+		}
+
+		b.journalStatus(nonce, JournalAborted, nil, err)
+		nonces.Release(nonce, tx)
+		if resyncErr := nonces.Resync(ctx); resyncErr != nil {
+			log.Println("[NonceResyncFailed]", b.Name, resyncErr)
+			return nil, err
+		}
+		if attempt > 0 || !isNonceError(err) {
+			return nil, err
+		}
+	}
+}
 
-	ctx := context.TODO()
+// SendTransaction sends a transaction and returns without waiting for it
+// to be mined
+func (b *Web3Client) SendTransaction(ctx context.Context, to *common.Address, value *big.Int, gasLimit uint64, calldata []byte) (*PendingTx, error) {
+	return b.sendIntent(ctx, "", to, value, gasLimit, calldata)
+}
 
-	network, err := b.Client.NetworkID(ctx)
+// sendIntent sends a transaction, intent describes it in the journal
+func (b *Web3Client) sendIntent(ctx context.Context, intent string, to *common.Address, value *big.Int, gasLimit uint64, calldata []byte) (*PendingTx, error) {
+
+	var err error
+
+	chainID, err := b.ChainID(ctx)
 	if err != nil {
-		return nil, nil, err
+		return nil, err
 	}
 
-	gasPrice, err := b.Client.SuggestGasPrice(ctx)
+	fees, err := b.Fees(ctx)
 	if err != nil {
-		return nil, nil, err
+		return nil, err
 	}
 
 	callmsg := ethereum.CallMsg{
@@ -109,7 +233,7 @@ func (b *Web3Client) SendTransactionSync(to *common.Address, value *big.Int, gas
 	}
 
 	if gasLimit == 0 {
-		gasLimit, err = b.Client.EstimateGas(ctx, callmsg)
+		gasLimit, err = b.conn().EstimateGas(ctx, callmsg)
 		if err != nil {
 			if cfg.Verbose > 0 {
 				log.Printf("Failed EstimateGas from=%v to=%v value=%v data=%v",
@@ -117,71 +241,47 @@ func (b *Web3Client) SendTransactionSync(to *common.Address, value *big.Int, gas
 					callmsg.Value, hex.EncodeToString(callmsg.Data),
 				)
 			}
-			return nil, nil, err
+			return nil, err
 		}
 	}
 
-	nonce, err := b.Client.NonceAt(ctx, b.Account.Address, nil)
+	tx, err := b.sendTransaction(ctx, chainID, intent, func(nonce uint64) *types.Transaction {
+		return newTransaction(chainID, nonce, to, value, gasLimit, fees, calldata)
+	})
 	if err != nil {
-		return nil, nil, err
-	}
-
-	if to == nil {
-		tx = types.NewContractCreation(
-			nonce,    // nonce int64
-			value,    // amount *big.Int
-			gasLimit, // gasLimit *big.Int
-			gasPrice, // gasPrice *big.Int
-			calldata, // data []byte
-		)
-	} else {
-		tx = types.NewTransaction(
-			nonce,    // nonce int64
-			*to,      // to common.Address
-			value,    // amount *big.Int
-			gasLimit, // gasLimit *big.Int
-			gasPrice, // gasPrice *big.Int
-			calldata, // data []byte
-		)
+		return nil, err
 	}
 
-	if tx, err = b.Ks.SignTx(b.Account, tx, network); err != nil {
-		return nil, nil, err
-	}
+	pending := newPendingTx(b, tx)
+	pending.journaled = b.Journal != nil
+	b.track(pending)
+	return pending, nil
+}
 
-	if cfg.Verbose > 0 {
-		log.Println(tx.String())
-	}
+// SendTransactionSync executes a contract method and wait it finalizes
+func (b *Web3Client) SendTransactionSync(ctx context.Context, to *common.Address, value *big.Int, gasLimit uint64, calldata []byte) (*types.Transaction, *types.Receipt, error) {
 
-	if err = b.Client.SendTransaction(ctx, tx); err != nil {
+	pending, err := b.SendTransaction(ctx, to, value, gasLimit, calldata)
+	if err != nil {
 		return nil, nil, err
 	}
 
-	start := time.Now()
-	for receipt == nil && time.Now().Sub(start) < b.ReceiptTimeout {
-		receipt, err = b.Client.TransactionReceipt(ctx, tx.Hash())
-		if receipt == nil {
-			time.Sleep(200 * time.Millisecond)
-		}
-	}
+	receipt, err := pending.Wait(ctx)
+	tx := pending.Transaction()
 
-	if receipt != nil && receipt.Status == types.ReceiptStatusFailed {
-		log.Println("FAILED RECEIPT TX", receipt.String())
-		return tx, receipt, ErrReceiptStatusFailed
+	if err == ErrReceiptStatusFailed {
+		log.Println("FAILED RECEIPT TX", dumpJSON(receipt))
 	}
 
-	if receipt == nil {
-		log.Println("FAILED TX", tx.String())
-		return tx, receipt, ErrReceiptNotRecieved
+	if err == ErrReceiptNotRecieved {
+		log.Println("FAILED TX", dumpJSON(tx))
 	}
 
 	return tx, receipt, err
 }
 
 // Call an constant method
-func (b *Web3Client) Call(to *common.Address, value *big.Int, calldata []byte) ([]byte, error) {
-
-	ctx := context.TODO()
+func (b *Web3Client) Call(ctx context.Context, to *common.Address, value *big.Int, calldata []byte) ([]byte, error) {
 
 	msg := ethereum.CallMsg{
 		From:  b.Account.Address,
@@ -190,19 +290,33 @@ func (b *Web3Client) Call(to *common.Address, value *big.Int, calldata []byte) (
 		Data:  calldata,
 	}
 
-	return b.Client.CallContract(ctx, msg, nil)
+	return b.conn().CallContract(ctx, msg, nil)
 }
 
-// RegisterEventHandler registers a function to be called on event emission
+// RegisterEventHandler registers a function to be called on event emission,
+// several handlers can be registered for the same event
 func (b *Web3Client) RegisterEventHandler(contract *Contract, event string, handler EventHandlerFunc) error {
 
 	abievent, ok := contract.Abi.Events[event]
 	if !ok {
 		return fmt.Errorf("Event %v not found", event)
 	}
-	topicID := abievent.Id()
+	topicID := abievent.ID
+
+	// several handlers of the same event are numbered
+	id := strings.ToLower(contract.Address.Hex()) + "-" + event
+	count := 0
+	for _, v := range b.EventHandlers {
+		if v.Address == *contract.Address && v.EventSignature == abievent.String() {
+			count++
+		}
+	}
+	if count > 0 {
+		id = fmt.Sprintf("%v-%v", id, count+1)
+	}
 
 	eventHandler := EventHandler{
+		ID:             id,
 		Address:        *contract.Address,
 		EventSignature: abievent.String(),
 		Topic:          "0x" + hex.EncodeToString(topicID[:]),
@@ -221,69 +335,11 @@ func debugLog(eventlog *types.Log) {
 	log.Println("  Data:", hex.EncodeToString(eventlog.Data))
 }
 
-// HandleEvents starts processing event handling
-func (b *Web3Client) HandleEvents(terminatech, terminatedch chan bool) error {
-
-	ctx := context.TODO()
-	ch := make(chan types.Log)
-
-	addrs := []common.Address{}
-
-	for _, v := range b.EventHandlers {
-		found := false
-		for _, addr := range addrs {
-			if addr == v.Address {
-				found = true
-				break
-			}
-		}
-		if !found {
-			addrs = append(addrs, v.Address)
-		}
-	}
-
-	query := ethereum.FilterQuery{
-		FromBlock: big.NewInt(0),
-		ToBlock:   big.NewInt(10000000),
-		Addresses: addrs,
-		Topics:    [][]common.Hash{{}},
-	}
-
-	_, err := b.Client.SubscribeFilterLogs(ctx, query, ch)
+// dumpJSON returns the json of a transaction or receipt, used for logging
+func dumpJSON(v interface{}) string {
+	json, err := json.Marshal(v)
 	if err != nil {
-		return err
+		return err.Error()
 	}
-
-	processEvent := func(logevent *types.Log) {
-		if logevent.Removed {
-			return
-		}
-		for _, v := range b.EventHandlers {
-			if logevent.Address == v.Address && logevent.Topics[0].Hex() == v.Topic {
-				if v.Handler != nil {
-					err := v.Handler(logevent)
-					if err != nil {
-						log.Println("[EventProcessingFailed]", v.EventSignature, err)
-					}
-				} else {
-					log.Println("[Event] ", v.EventSignature)
-				}
-				return
-			}
-		}
-	}
-
-	go func() {
-		for true {
-			select {
-			case logevent := <-ch:
-				go processEvent(&logevent)
-			case <-terminatech:
-				terminatedch <- true
-				return
-			}
-		}
-	}()
-
-	return nil
+	return string(json)
 }
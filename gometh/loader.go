@@ -1,13 +1,15 @@
 package gometh
 
 import (
+	"context"
 	"fmt"
 	"log"
 	"math/big"
-	"sync"
+	"time"
 
 	cfg "github.com/adriamb/gometh-server/gometh/config"
 	eth "github.com/adriamb/gometh-server/gometh/eth"
+	store "github.com/adriamb/gometh-server/gometh/store"
 	"github.com/ethereum/go-ethereum/accounts"
 	"github.com/ethereum/go-ethereum/accounts/keystore"
 	"github.com/ethereum/go-ethereum/common"
@@ -27,43 +29,205 @@ var (
 	wethContract *eth.Contract
 )
 
-func initClient() {
-	// -- open keystore
+// gwei converts gwei to wei, 0 is nil
+func gwei(value float64) *big.Int {
+	if value == 0 {
+		return nil
+	}
+	wei, _ := new(big.Float).Mul(big.NewFloat(value), big.NewFloat(1e9)).Int(nil)
+	return wei
+}
 
-	var err error
-	var account accounts.Account
+func gasStrategy(gas *cfg.GasConfig) (eth.GasStrategy, error) {
+	switch gas.Strategy {
+	case "", "oracle":
+		return &eth.OracleGasStrategy{}, nil
+	case "fixed":
+		if gas.Price == 0 && gas.TipCap == 0 {
+			return nil, fmt.Errorf("Fixed gas strategy needs Price or TipCap")
+		}
+		return &eth.FixedGasStrategy{
+			GasPrice:  gwei(gas.Price),
+			GasFeeCap: gwei(gas.FeeCap),
+			GasTipCap: gwei(gas.TipCap),
+		}, nil
+	case "percentile":
+		strategy := &eth.PercentileGasStrategy{Blocks: gas.Blocks, Percentile: gas.Percentile}
+		if strategy.Blocks == 0 {
+			strategy.Blocks = 20
+		}
+		if strategy.Percentile == 0 {
+			strategy.Percentile = 50
+		}
+		if strategy.Blocks < 0 {
+			return nil, fmt.Errorf("Percentile gas strategy needs Blocks > 0, got %v", gas.Blocks)
+		}
+		if strategy.Percentile < 0 || strategy.Percentile > 100 {
+			return nil, fmt.Errorf("Percentile gas strategy needs 0 < Percentile <= 100, got %v", gas.Percentile)
+		}
+		return strategy, nil
+	case "zero":
+		return &eth.ZeroGasStrategy{}, nil
+	}
+	return nil, fmt.Errorf("Unknown gas strategy %v", gas.Strategy)
+}
+
+func configureClient(client *eth.Web3Client, chain *cfg.ChainConfig) {
+	client.StartBlock = chain.StartBlock
+	client.Confirmations = chain.Confirmations
+	client.PollInterval = time.Duration(chain.PollInterval) * time.Second
+	client.EventWorkers = chain.EventWorkers
+	if chain.BlockWindow > 0 {
+		client.BlockWindow = chain.BlockWindow
+	}
+	if chain.ReceiptTimeout > 0 {
+		client.ReceiptTimeout = time.Duration(chain.ReceiptTimeout) * time.Second
+	}
+
+	switch txType := eth.TxType(chain.Gas.TxType); txType {
+	case "":
+	case eth.TxTypeAuto, eth.TxTypeLegacy, eth.TxTypeDynamic:
+		client.TxType = txType
+	default:
+		assert(fmt.Errorf("Unknown transaction type %v", txType))
+	}
+	strategy, err := gasStrategy(&chain.Gas)
+	assert(err)
+	client.GasStrategy = strategy
+	client.GasCaps = eth.GasCaps{
+		MaxGasPrice:  gwei(chain.Gas.MaxPrice),
+		MaxGasFeeCap: gwei(chain.Gas.MaxFeeCap),
+		MaxGasTipCap: gwei(chain.Gas.MaxTipCap),
+	}
+
+	client.ReplacePolicy.After = time.Duration(chain.Gas.ReplaceAfter) * time.Second
+	client.ReplacePolicy.MaxFee = gwei(chain.Gas.ReplaceMaxFee)
+	if chain.Gas.ReplaceBump > 0 {
+		if chain.Gas.ReplaceBump < 10 {
+			assert(fmt.Errorf("ReplaceBump must be at least 10, was %v", chain.Gas.ReplaceBump))
+		}
+		client.ReplacePolicy.BumpPercent = chain.Gas.ReplaceBump
+	}
+}
+
+var ks *keystore.KeyStore
+
+func openKeystore() *keystore.KeyStore {
+	if ks == nil {
+		ks = keystore.NewKeyStore(cfg.C.Keystore.Path, keystore.StandardScryptN, keystore.StandardScryptP)
+	}
+	return ks
+}
+
+// selectAccount returns the keystore account with the address, if address
+// is empty the keystore must have only one account
+func selectAccount(ks *keystore.KeyStore, address string) (accounts.Account, error) {
 
-	ks := keystore.NewKeyStore(cfg.C.Keystore.Path, keystore.StandardScryptN, keystore.StandardScryptP)
-	if len(ks.Accounts()) != 1 {
-		panic(fmt.Sprintf("Not exact one account in keystore, was %v", len(ks.Accounts())))
+	if address == "" {
+		if len(ks.Accounts()) != 1 {
+			return accounts.Account{}, fmt.Errorf("Not exact one account in keystore, was %v, set the Address of the signer", len(ks.Accounts()))
+		}
+		return ks.Accounts()[0], nil
 	}
-	account = ks.Accounts()[0]
-	assert(ks.Unlock(account, cfg.C.Keystore.Passwd))
+
+	if !common.IsHexAddress(address) {
+		return accounts.Account{}, fmt.Errorf("Bad signer address %v", address)
+	}
+	account, err := ks.Find(accounts.Account{Address: common.HexToAddress(address)})
+	if err != nil {
+		return accounts.Account{}, fmt.Errorf("Account %v not found in keystore", address)
+	}
+	return account, nil
+}
+
+func newSigner(c *cfg.SignerConfig) (eth.Signer, error) {
+
+	var address common.Address
+	if c.Address != "" {
+		if !common.IsHexAddress(c.Address) {
+			return nil, fmt.Errorf("Bad signer address %v", c.Address)
+		}
+		address = common.HexToAddress(c.Address)
+	}
+
+	switch c.Type {
+	case "", "keystore":
+		ks := openKeystore()
+		account, err := selectAccount(ks, c.Address)
+		if err != nil {
+			return nil, err
+		}
+		passwd, err := signerPasswd(c)
+		if err != nil {
+			return nil, err
+		}
+		if err := ks.Unlock(account, passwd); err != nil {
+			return nil, err
+		}
+		return eth.NewKeystoreSigner(ks, account), nil
+
+	case "keyfile":
+		passwd, err := signerPasswd(c)
+		if err != nil {
+			return nil, err
+		}
+		return eth.NewKeyFileSigner(c.KeyFile, passwd)
+
+	case "external":
+		return eth.NewExternalSigner(c.Endpoint, address)
+	}
+
+	return nil, fmt.Errorf("Unknown signer type %v", c.Type)
+}
+
+// newSender returns the signer of the account that sends the transactions
+// of the chain
+func newSender(chain *cfg.ChainConfig, signer eth.Signer) (eth.Signer, error) {
+	if chain.Sender == (cfg.SignerConfig{}) {
+		return signer, nil
+	}
+	return newSigner(&chain.Sender)
+}
+
+func initClient(ctx context.Context) {
+	// -- open signers
+
+	var err error
+
+	signer, err := newSigner(&cfg.C.Signer)
+	assert(err)
+	log.Println("Bridge signer", signer.Account().Address.Hex())
+
+	mainSender, err := newSender(&cfg.C.MainChain, signer)
+	assert(err)
+	sideSender, err := newSender(&cfg.C.SideChain, signer)
+	assert(err)
 
 	// -- create clients
 
 	mainClient, err = eth.NewWeb3Client(
 		cfg.C.MainChain.RPCURL,
-		ks,
-		account,
+		mainSender,
 	)
 	assert(err)
+	mainClient.Name = "main"
+	mainClient.Context = ctx
+	configureClient(mainClient, &cfg.C.MainChain)
 
 	sideClient, err = eth.NewWeb3Client(
 		cfg.C.SideChain.RPCURL,
-		ks,
-		account,
+		sideSender,
 	)
 	assert(err)
+	sideClient.Name = "side"
+	sideClient.Context = ctx
+	configureClient(sideClient, &cfg.C.SideChain)
 
-	mainClient.ClientMutex = &sync.Mutex{}
-	sideClient.ClientMutex = mainClient.ClientMutex
-
-	parentAccountInfo, err := mainClient.AccountInfo()
+	parentAccountInfo, err := mainClient.AccountInfo(ctx)
 	assert(err)
 	log.Println("Parent chain account: ", parentAccountInfo)
 
-	childAccountInfo, err := sideClient.AccountInfo()
+	childAccountInfo, err := sideClient.AccountInfo(ctx)
 	assert(err)
 	log.Println("Child chain account", childAccountInfo)
 
@@ -77,9 +241,14 @@ func initClient() {
 	wethContract, err = eth.NewContract(sideClient, cfg.C.Contracts.Path+"/WETH.json")
 	assert(err)
 
+	mainContract.BridgeSigner = signer
+	sideContract.BridgeSigner = signer
+
+	loadTokens()
+
 }
 
-func deployContracts() {
+func deployContracts(ctx context.Context) {
 
 	var err error
 
@@ -95,38 +264,108 @@ func deployContracts() {
 	}
 
 	// -- deploy contracts
-	_, _, err = mainContract.Deploy(initialSigners)
+	_, _, err = mainContract.Deploy(ctx, initialSigners)
 	assert(err)
 	log.Println("GomethMain deployed at ", mainContract.Address.Hex())
-	_, _, err = sideContract.Deploy(initialSigners)
+	_, _, err = sideContract.Deploy(ctx, initialSigners)
 
 	assert(err)
 	log.Println("GometSide deployed at ", sideContract.Address.Hex())
-	_, _, err = wethContract.Deploy(sideContract.Address)
+	_, _, err = wethContract.Deploy(ctx, sideContract.Address)
 
 	assert(err)
 	log.Println("WETH deployed at ", wethContract.Address.Hex())
 
 	// -- set weth address
-	_, _, err = sideContract.SendTransactionSync(big.NewInt(0), 0, "init", wethContract.Address)
+	_, _, err = sideContract.SendTransactionSync(ctx, big.NewInt(0), 0, "init", wethContract.Address)
 	assert(err)
 	log.Println("WETH attached to GometSide")
+
+	deployTokens(ctx)
+}
+
+func openStore() *store.Store {
+
+	if cfg.C.DataDir == "" {
+		assert(fmt.Errorf("DataDir is not set"))
+	}
+
+	datastore, err := store.Open(cfg.C.DataDir)
+	assert(err)
+
+	return datastore
+}
+
+func openDeadLetters() *eth.DeadLetterStore {
+	deadletters, err := eth.NewDeadLetterStore(openStore())
+	assert(err)
+	return deadletters
+}
+
+func openJournal() *eth.TxJournal {
+	journal, err := eth.NewTxJournal(openStore())
+	assert(err)
+	return journal
 }
 
-func setContractsAddress() {
+func initStore(ctx context.Context) {
+
+	datastore := openStore()
+
+	checkpoints, err := eth.NewCheckpointStore(datastore)
+	assert(err)
+
+	deadletters, err := eth.NewDeadLetterStore(datastore)
+	assert(err)
+
+	policy := eth.DefaultRetryPolicy
+	if cfg.C.DeadLetters.MaxAttempts > 0 {
+		policy.MaxAttempts = cfg.C.DeadLetters.MaxAttempts
+	}
+	if cfg.C.DeadLetters.MinBackoff > 0 {
+		policy.MinBackoff = time.Duration(cfg.C.DeadLetters.MinBackoff) * time.Second
+	}
+	if cfg.C.DeadLetters.MaxBackoff > 0 {
+		policy.MaxBackoff = time.Duration(cfg.C.DeadLetters.MaxBackoff) * time.Second
+	}
+
+	signings, err := eth.NewSigningJournal(datastore)
+	assert(err)
+	sideContract.Signings = signings
+
+	journal, err := eth.NewTxJournal(datastore)
+	assert(err)
+
+	if cfg.C.Relayer.Enabled {
+		relays, err = newRelayer(datastore)
+		assert(err)
+	}
+
+	for _, client := range []*eth.Web3Client{mainClient, sideClient} {
+		client.Checkpoints = checkpoints
+		client.DeadLetters = deadletters
+		client.RetryPolicy = policy
+		client.Journal = journal
+		assert(client.ReconcileJournal(ctx))
+	}
+}
+
+func setContractsAddress(ctx context.Context) {
 
 	assert(cfg.C.VerifyAddresses())
 
-	mainContract.SetAddress(common.HexToAddress(cfg.C.MainChain.BridgeAddress))
+	mainContract.SetAddress(ctx, common.HexToAddress(cfg.C.MainChain.BridgeAddress))
 	log.Println("GomethMain address is ", mainContract.Address.Hex())
 
-	sideContract.SetAddress(common.HexToAddress(cfg.C.SideChain.BridgeAddress))
+	sideContract.SetAddress(ctx, common.HexToAddress(cfg.C.SideChain.BridgeAddress))
 	log.Println("GometSide address is ", sideContract.Address.Hex())
 
 	// -- get weth address
 	var wethAddress common.Address
-	assert(sideContract.Call(&wethAddress, "weth"))
-	wethContract.SetAddress(wethAddress)
+	assert(sideContract.Call(ctx, &wethAddress, "weth"))
+	wethContract.SetAddress(ctx, wethAddress)
 	log.Println("WETH address is ", wethContract.Address.Hex())
 
+	setTokensAddress(ctx)
+
 }
@@ -0,0 +1,143 @@
+package gometh
+
+import (
+	"fmt"
+	"io/ioutil"
+	"log"
+	"os"
+	"os/exec"
+	"runtime"
+	"strings"
+
+	cfg "github.com/adriamb/gometh-server/gometh/config"
+
+	"golang.org/x/term"
+)
+
+// passwds are the passwords already read, so each source is read once
+var passwds = make(map[cfg.PasswdConfig]string)
+
+// readPasswd reads the password from its source, name identifies it in the
+// prompt and the errors
+func readPasswd(name string, c *cfg.PasswdConfig) (string, error) {
+
+	if passwd, ok := passwds[*c]; ok {
+		return passwd, nil
+	}
+
+	passwd, err := readPasswdSource(name, c)
+	if err != nil {
+		return "", err
+	}
+
+	passwds[*c] = passwd
+	return passwd, nil
+}
+
+// readPasswdSource reads the password from its source, without keeping it
+// for the next reads
+func readPasswdSource(name string, c *cfg.PasswdConfig) (string, error) {
+
+	var passwd string
+	var err error
+
+	switch {
+	case c.PasswdFile != "":
+		passwd, err = passwdFromFile(c.PasswdFile)
+	case c.PasswdEnv != "":
+		passwd, err = passwdFromEnv(c.PasswdEnv)
+	case c.PasswdCommand != "":
+		passwd, err = passwdFromCommand(c.PasswdCommand)
+	case c.PasswdPrompt:
+		passwd, err = passwdFromPrompt(name)
+	default:
+		if c.Passwd != "" {
+			log.Printf("[InsecurePasswd] %v password is in plaintext in the config, set PasswdFile, PasswdEnv, PasswdCommand or PasswdPrompt", name)
+		}
+		passwd = c.Passwd
+	}
+	if err != nil {
+		return "", fmt.Errorf("Cannot read %v password: %v", name, err)
+	}
+	return passwd, nil
+}
+
+// keystorePasswd returns the password of the keystore accounts
+func keystorePasswd() (string, error) {
+	return readPasswd("keystore", &cfg.C.Keystore.PasswdConfig)
+}
+
+// signerPasswd returns the password of the signer, the keystore one if it
+// has no source
+func signerPasswd(c *cfg.SignerConfig) (string, error) {
+	if !c.PasswdConfig.IsSet() {
+		return keystorePasswd()
+	}
+	return readPasswd("signer", &c.PasswdConfig)
+}
+
+// passwdFromFile reads the first line of the file, that must be readable
+// only by its owner
+func passwdFromFile(path string) (string, error) {
+
+	info, err := os.Stat(path)
+	if err != nil {
+		return "", err
+	}
+	if runtime.GOOS != "windows" && info.Mode().Perm()&0077 != 0 {
+		return "", fmt.Errorf("File %v is accessible by other users, mode %#o, it should be 0600", path, info.Mode().Perm())
+	}
+
+	content, err := ioutil.ReadFile(path)
+	if err != nil {
+		return "", err
+	}
+	return firstLine(content), nil
+}
+
+// passwdFromEnv reads the variable and removes it from the environment, so
+// it is not inherited by child processes
+func passwdFromEnv(name string) (string, error) {
+	passwd, ok := os.LookupEnv(name)
+	if !ok {
+		return "", fmt.Errorf("Environment variable %v is not set", name)
+	}
+	os.Unsetenv(name)
+	return passwd, nil
+}
+
+// passwdFromCommand runs the command with the shell, the password is the
+// first line of its output
+func passwdFromCommand(command string) (string, error) {
+	cmd := exec.Command("sh", "-c", command)
+	cmd.Stdin = os.Stdin
+	cmd.Stderr = os.Stderr
+	output, err := cmd.Output()
+	if err != nil {
+		return "", fmt.Errorf("Command failed: %v", err)
+	}
+	return firstLine(output), nil
+}
+
+// passwdFromPrompt asks for the password in the terminal without echoing it
+func passwdFromPrompt(name string) (string, error) {
+	fd := int(os.Stdin.Fd())
+	if !term.IsTerminal(fd) {
+		return "", fmt.Errorf("Cannot prompt, stdin is not a terminal")
+	}
+	fmt.Fprintf(os.Stderr, "Enter %v password: ", name)
+	passwd, err := term.ReadPassword(fd)
+	fmt.Fprintln(os.Stderr)
+	if err != nil {
+		return "", err
+	}
+	return string(passwd), nil
+}
+
+func firstLine(content []byte) string {
+	line := string(content)
+	if i := strings.IndexAny(line, "\r\n"); i >= 0 {
+		line = line[:i]
+	}
+	return line
+}
@@ -0,0 +1,74 @@
+package gometh
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+
+	cfg "github.com/adriamb/gometh-server/gometh/config"
+)
+
+func TestReadPasswdSource(t *testing.T) {
+
+	dir := t.TempDir()
+	private := filepath.Join(dir, "private")
+	if err := os.WriteFile(private, []byte("file\nsecond line\n"), 0600); err != nil {
+		t.Fatal(err)
+	}
+	shared := filepath.Join(dir, "shared")
+	if err := os.WriteFile(shared, []byte("shared\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		config cfg.PasswdConfig
+		passwd string
+		fails  bool
+	}{
+		{cfg.PasswdConfig{Passwd: "plain"}, "plain", false},
+		{cfg.PasswdConfig{Passwd: "plain", PasswdCommand: "echo command"}, "command", false},
+		{cfg.PasswdConfig{PasswdCommand: "echo command", PasswdEnv: "GOMETH_TEST_PASSWD"}, "env", false},
+		{cfg.PasswdConfig{PasswdEnv: "GOMETH_TEST_PASSWD", PasswdFile: private}, "file", false},
+		{cfg.PasswdConfig{PasswdFile: shared}, "", true},
+		{cfg.PasswdConfig{PasswdEnv: "GOMETH_TEST_UNSET"}, "", true},
+		{cfg.PasswdConfig{PasswdCommand: "exit 1"}, "", true},
+		{cfg.PasswdConfig{}, "", false},
+	}
+
+	for _, test := range tests {
+		os.Setenv("GOMETH_TEST_PASSWD", "env")
+		passwd, err := readPasswdSource("test", &test.config)
+		if (err != nil) != test.fails || passwd != test.passwd {
+			t.Errorf("%+v: read %q, %v", test.config, passwd, err)
+		}
+	}
+	os.Unsetenv("GOMETH_TEST_PASSWD")
+
+	// the variable is not inherited by the commands run later
+	os.Setenv("GOMETH_TEST_PASSWD", "env")
+	if _, err := readPasswdSource("test", &cfg.PasswdConfig{PasswdEnv: "GOMETH_TEST_PASSWD"}); err != nil {
+		t.Fatal(err)
+	}
+	if _, set := os.LookupEnv("GOMETH_TEST_PASSWD"); set {
+		t.Errorf("GOMETH_TEST_PASSWD is still in the environment")
+	}
+}
+
+func TestRedactedPasswd(t *testing.T) {
+
+	c := cfg.Config{}
+	c.Keystore.Passwd = "plain"
+	c.Keystore.PasswdFile = "/run/secrets/keystore"
+	c.Signer.PasswdCommand = "pass show gometh"
+
+	r := c.Redacted()
+	if r.Keystore.Passwd == "plain" || r.Signer.PasswdCommand == "pass show gometh" {
+		t.Errorf("secrets not redacted, %+v %+v", r.Keystore.PasswdConfig, r.Signer.PasswdConfig)
+	}
+	if r.Keystore.PasswdFile != c.Keystore.PasswdFile {
+		t.Errorf("PasswdFile redacted")
+	}
+	if c.Keystore.Passwd != "plain" {
+		t.Errorf("the config was redacted")
+	}
+}
@@ -0,0 +1,77 @@
+package gometh
+
+import (
+	"context"
+	"encoding/hex"
+	"fmt"
+	"log"
+	"math/big"
+
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/core/types"
+)
+
+// redeemMethod is the method of the main contract that releases the ether,
+// or tokens, of a burn signed by the validators
+const redeemMethod = "unlock"
+
+// redeem submits the voucher to the main contract to release the ether, a
+// redeem already sent is resumed instead of sent again
+func redeem(ctx context.Context, voucher *Voucher) (*types.Transaction, *types.Receipt, error) {
+
+	if _, ok := mainContract.Abi.Methods[redeemMethod]; !ok {
+		return nil, nil, fmt.Errorf("Main contract has no %v method", redeemMethod)
+	}
+	if voucher.MainContract != *mainContract.Address {
+		return nil, nil, fmt.Errorf("Voucher is for main contract %v", voucher.MainContract.Hex())
+	}
+	if voucher.MainChainID != nil {
+		chainID, err := mainClient.ChainID(ctx)
+		if err != nil {
+			return nil, nil, err
+		}
+		if voucher.MainChainID.ToInt().Cmp(chainID) != 0 {
+			return nil, nil, fmt.Errorf("Voucher is for main chain %v, connected to %v", voucher.MainChainID.ToInt(), chainID)
+		}
+	}
+
+	intent := "redeem " + hex.EncodeToString(voucher.TxID[:])
+	log.Println("SEND", redeemMethod, hex.EncodeToString(voucher.TxID[:]))
+
+	return mainContract.SendIntentSync(
+		ctx, intent, big.NewInt(0), 0,
+		redeemMethod, voucher.TxID, voucher.Epoch.ToInt(), []byte(voucher.Data), voucher.sigs(),
+	)
+}
+
+// callRedeem redeems the burn txid, or the voucher file if txid is empty,
+// and prints the receipt
+func callRedeem(ctx context.Context, txid string, voucherFile string) error {
+
+	var voucher *Voucher
+	var err error
+
+	if voucherFile != "" {
+		voucher, err = readVoucher(voucherFile)
+	} else {
+		if len(common.FromHex(txid)) != common.HashLength {
+			return fmt.Errorf("Bad txid %v", txid)
+		}
+		voucher, err = fetchVoucher(ctx, common.HexToHash(txid))
+	}
+	if err != nil {
+		return err
+	}
+
+	tx, receipt, err := redeem(ctx, voucher)
+	if err != nil {
+		return err
+	}
+
+	fmt.Println("Redeemed", voucher.Value.ToInt(), voucher.unit(), "to", voucher.Recipient.Hex())
+	fmt.Println("  transaction :", tx.Hash().Hex())
+	fmt.Println("  block       :", receipt.BlockNumber)
+	fmt.Println("  gas used    :", receipt.GasUsed)
+	fmt.Println("  status      :", receipt.Status)
+	return nil
+}
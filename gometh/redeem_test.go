@@ -0,0 +1,83 @@
+package gometh
+
+import (
+	"context"
+	"math/big"
+	"strings"
+	"testing"
+
+	eth "github.com/adriamb/gometh-server/gometh/eth"
+
+	"github.com/ethereum/go-ethereum/accounts/abi"
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/common/hexutil"
+	"github.com/ethereum/go-ethereum/ethclient"
+	"github.com/ethereum/go-ethereum/rpc"
+)
+
+const redeemTestAbi = `[
+	{"type":"function","name":"unlock","inputs":[
+		{"name":"txid","type":"bytes32"},
+		{"name":"epoch","type":"uint256"},
+		{"name":"data","type":"bytes"},
+		{"name":"sigs","type":"bytes32[]"}],"outputs":[]}
+]`
+
+type redeemTestEth struct{}
+
+func (s *redeemTestEth) ChainId() *hexutil.Big {
+	return (*hexutil.Big)(big.NewInt(1))
+}
+
+// TestRedeemChecks checks that the vouchers of other contracts or chains
+// are rejected before sending them
+func TestRedeemChecks(t *testing.T) {
+
+	server := rpc.NewServer()
+	if err := server.RegisterName("eth", &redeemTestEth{}); err != nil {
+		t.Fatal(err)
+	}
+	parsed, err := abi.JSON(strings.NewReader(redeemTestAbi))
+	if err != nil {
+		t.Fatal(err)
+	}
+	address := common.HexToAddress("0x1111111111111111111111111111111111111111")
+
+	oldClient, oldContract := mainClient, mainContract
+	defer func() { mainClient, mainContract = oldClient, oldContract }()
+	mainClient = &eth.Web3Client{Client: ethclient.NewClient(rpc.DialInProc(server))}
+	mainContract = &eth.Contract{Abi: parsed, Client: mainClient, Address: &address}
+
+	tests := []struct {
+		name    string
+		voucher *Voucher
+		abi     abi.ABI
+		err     string
+	}{
+		{
+			name:    "contract without unlock",
+			voucher: &Voucher{MainContract: address},
+			err:     "has no unlock method",
+		},
+		{
+			name:    "other contract",
+			voucher: &Voucher{MainContract: common.HexToAddress("0x2222222222222222222222222222222222222222")},
+			abi:     parsed,
+			err:     "is for main contract",
+		},
+		{
+			name:    "other chain",
+			voucher: &Voucher{MainContract: address, MainChainID: (*hexutil.Big)(big.NewInt(5))},
+			abi:     parsed,
+			err:     "is for main chain 5, connected to 1",
+		},
+	}
+
+	for _, test := range tests {
+		mainContract.Abi = test.abi
+		_, _, err := redeem(context.Background(), test.voucher)
+		if err == nil || !strings.Contains(err.Error(), test.err) {
+			t.Errorf("%v: got %v, expected %q", test.name, err, test.err)
+		}
+	}
+}
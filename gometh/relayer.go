@@ -0,0 +1,319 @@
+package gometh
+
+import (
+	"bytes"
+	"context"
+	"encoding/hex"
+	"log"
+	"math/big"
+	"sort"
+	"strings"
+	"time"
+
+	cfg "github.com/adriamb/gometh-server/gometh/config"
+	eth "github.com/adriamb/gometh-server/gometh/eth"
+	"github.com/adriamb/gometh-server/gometh/store"
+
+	"github.com/ethereum/go-ethereum/accounts/abi"
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/core/types"
+	"github.com/ethereum/go-ethereum/crypto"
+)
+
+const (
+	// relayInterval is how often the due relays are checked
+	relayInterval = 5 * time.Second
+	// relayFeeWait is how long a relay waits if the fees are over MaxFee
+	relayFeeWait = time.Minute
+	// relayMaxAttempts is the number of times a failed relay is sent
+	relayMaxAttempts = 5
+	// defaultRelayDelay is the Delay between validators if not set
+	defaultRelayDelay = time.Minute
+	// defaultRedeemedMethod is the RedeemedMethod if not set
+	defaultRedeemedMethod = "redeemed"
+	// defaultRedeemedReason is the RedeemedReason if not set
+	defaultRedeemedReason = "already redeemed"
+)
+
+// RelayStatus is the status of the relay of a burn
+type RelayStatus string
+
+const (
+	// RelayPending when the relay is waiting its turn
+	RelayPending RelayStatus = "pending"
+	// RelayDone when this validator redeemed the burn
+	RelayDone RelayStatus = "relayed"
+	// RelaySkipped when the redeem was rejected because another validator
+	// or the user redeemed it before
+	RelaySkipped RelayStatus = "skipped"
+	// RelayFailed when all the attempts failed
+	RelayFailed RelayStatus = "failed"
+)
+
+// relay is a multisigned burn to be redeemed in the main chain
+type relay struct {
+	Voucher  *Voucher
+	Status   RelayStatus
+	Due      time.Time
+	Attempts int
+	TxHash   string
+	Error    string
+}
+
+// relayer redeems the multisigned burns on behalf of the users. All the
+// validators relay each burn in turns, in an order that changes with each
+// burn, and the redeem is rejected by the contract for all but the first.
+// The pending relays are in relays, and moved to done when final.
+type relayer struct {
+	relays *store.Store
+	done   *store.Store
+	delay  time.Duration
+	// method is the getter of the redeemed burns, empty if the main
+	// contract has none and the revert reason is checked instead
+	method   string
+	redeemed string
+}
+
+// relays is the relayer of the server, nil if disabled
+var relays *relayer
+
+func newRelayer(datastore *store.Store) (*relayer, error) {
+	bucket, err := datastore.Bucket("relays")
+	if err != nil {
+		return nil, err
+	}
+	done, err := datastore.Bucket("relays-done")
+	if err != nil {
+		return nil, err
+	}
+	delay := defaultRelayDelay
+	if cfg.C.Relayer.Delay > 0 {
+		delay = time.Duration(cfg.C.Relayer.Delay) * time.Second
+	}
+	method := defaultRedeemedMethod
+	if cfg.C.Relayer.RedeemedMethod != "" {
+		method = cfg.C.Relayer.RedeemedMethod
+	}
+	if !isRedeemedGetter(mainContract.Abi.Methods[method]) {
+		log.Printf("[RelayRedeemedUnchecked] main contract has no %v(bytes32) returns (bool), the redeemed burns are detected by the revert reason", method)
+		method = ""
+	}
+	redeemed := defaultRedeemedReason
+	if cfg.C.Relayer.RedeemedReason != "" {
+		redeemed = cfg.C.Relayer.RedeemedReason
+	}
+	return &relayer{bucket, done, delay, method, strings.ToLower(redeemed)}, nil
+}
+
+// isRedeemedGetter returns true if the method is a redeemed(bytes32)
+// returns (bool) getter
+func isRedeemedGetter(method abi.Method) bool {
+	return len(method.Inputs) == 1 && method.Inputs[0].Type.String() == "bytes32" &&
+		len(method.Outputs) == 1 && method.Outputs[0].Type.T == abi.BoolTy
+}
+
+// ether converts ether to wei
+func ether(value float64) *big.Int {
+	wei, _ := new(big.Float).Mul(big.NewFloat(value), big.NewFloat(1e18)).Int(nil)
+	return wei
+}
+
+// turn returns the position of the validator in the relay order of the
+// burn, the signers sorted by keccak(txid, signer). A validator that did not
+// sign goes after all the signers.
+func turn(txid common.Hash, signers []common.Address, validator common.Address) int {
+
+	key := func(addr common.Address) []byte {
+		return crypto.Keccak256(txid[:], addr[:])
+	}
+	sort.Slice(signers, func(i, j int) bool {
+		return bytes.Compare(key(signers[i]), key(signers[j])) < 0
+	})
+	for i, signer := range signers {
+		if signer == validator {
+			return i
+		}
+	}
+	return len(signers)
+}
+
+// schedule adds the relay of a multisigned burn, due when it is the turn of
+// this validator, burns below min are not relayed
+func (r *relayer) schedule(ctx context.Context, txid common.Hash, value *big.Int, min *big.Int) error {
+
+	key := hex.EncodeToString(txid[:])
+	if found, err := r.relays.Has(key); err != nil || found {
+		return err
+	}
+	if found, err := r.done.Has(key); err != nil || found {
+		return err
+	}
+
+	if min != nil && value.Cmp(min) < 0 {
+		log.Println("[RelaySkipped]", key, "value", value, "is below MinValue")
+		return nil
+	}
+
+	voucher, err := fetchVoucher(ctx, txid)
+	if err != nil {
+		return err
+	}
+	signers, err := voucher.Signers()
+	if err != nil {
+		return err
+	}
+
+	position := turn(txid, signers, mainContract.BridgeSigner.Account().Address)
+	entry := &relay{
+		Voucher: voucher,
+		Status:  RelayPending,
+		Due:     time.Now().Add(time.Duration(position) * r.delay),
+	}
+	log.Printf("Relay of %v scheduled in position %v, at %v", key, position, entry.Due.Format(time.RFC3339))
+
+	return r.relays.Put(key, entry)
+}
+
+// feesOver returns true if the current fees of the main chain are over
+// MaxFee
+func (r *relayer) feesOver(ctx context.Context) (bool, error) {
+	if cfg.C.Relayer.MaxFee == 0 {
+		return false, nil
+	}
+	fees, err := mainClient.Fees(ctx)
+	if err != nil {
+		return false, err
+	}
+	price := fees.GasPrice
+	if fees.Dynamic() {
+		price = fees.GasFeeCap
+	}
+	return price.Cmp(gwei(cfg.C.Relayer.MaxFee)) > 0, nil
+}
+
+// process redeems a due relay, unless the fees are too high
+func (r *relayer) process(ctx context.Context, key string, entry *relay) {
+
+	over, err := r.feesOver(ctx)
+	if err != nil {
+		log.Println("[RelayFailed]", key, err)
+		return
+	}
+	if over {
+		log.Println("[RelayDelayed]", key, "fees are over MaxFee")
+		entry.Due = time.Now().Add(relayFeeWait)
+		r.save(key, entry)
+		return
+	}
+
+	redeemed, err := r.isRedeemed(ctx, entry.Voucher.TxID)
+	if err != nil {
+		log.Println("[RelayFailed]", key, err)
+		return
+	}
+	if redeemed {
+		entry.Status = RelaySkipped
+		log.Println("[RelaySkipped]", key, "already redeemed")
+		r.save(key, entry)
+		return
+	}
+
+	var tx *types.Transaction
+	tx, _, err = redeem(ctx, entry.Voucher)
+	if ctx.Err() != nil {
+		return
+	}
+
+	entry.Attempts++
+	switch {
+	case err == nil:
+		entry.Status = RelayDone
+		entry.TxHash = tx.Hash().Hex()
+		log.Println("[Relayed]", key, entry.TxHash)
+	case r.alreadyRedeemed(err):
+		entry.Status = RelaySkipped
+		entry.Error = err.Error()
+		log.Println("[RelaySkipped]", key, err)
+	default:
+		entry.Error = err.Error()
+		entry.Due = time.Now().Add(r.delay)
+		if entry.Attempts >= relayMaxAttempts {
+			entry.Status = RelayFailed
+		}
+		log.Println("[RelayFailed]", key, err)
+	}
+	r.save(key, entry)
+}
+
+// isRedeemed returns true if the main contract says the burn was redeemed,
+// false if it has no getter
+func (r *relayer) isRedeemed(ctx context.Context, txid [32]byte) (bool, error) {
+	if r.method == "" {
+		return false, nil
+	}
+	var redeemed bool
+	err := mainContract.Call(ctx, &redeemed, r.method, txid)
+	return redeemed, err
+}
+
+// alreadyRedeemed returns true if the redeem was reverted because the burn
+// was already redeemed, other reverts are failures
+func (r *relayer) alreadyRedeemed(err error) bool {
+	revert, ok := err.(*eth.RevertError)
+	return ok && strings.Contains(strings.ToLower(revert.Reason), r.redeemed)
+}
+
+// save stores the relay, the final ones are moved out of the pending relays
+func (r *relayer) save(key string, entry *relay) {
+	if entry.Status == RelayPending {
+		if err := r.relays.Put(key, entry); err != nil {
+			log.Println("[RelayFailed]", key, err)
+		}
+		return
+	}
+	if err := r.done.Put(key, entry); err != nil {
+		log.Println("[RelayFailed]", key, err)
+		return
+	}
+	if err := r.relays.Delete(key); err != nil {
+		log.Println("[RelayFailed]", key, err)
+	}
+}
+
+// run processes the due relays until ctx is cancelled
+func (r *relayer) run(ctx context.Context) {
+
+	ticker := time.NewTicker(relayInterval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ticker.C:
+		case <-ctx.Done():
+			return
+		}
+
+		keys, err := r.relays.Keys()
+		if err != nil {
+			log.Println("[RelayFailed]", err)
+			continue
+		}
+		for _, key := range keys {
+			var entry relay
+			if err := r.relays.Get(key, &entry); err != nil {
+				log.Println("[RelayFailed]", key, err)
+				continue
+			}
+			switch {
+			case entry.Status != RelayPending:
+				// final relays saved before they were moved to done
+				r.save(key, &entry)
+			case time.Now().After(entry.Due):
+				r.process(ctx, key, &entry)
+			}
+			if ctx.Err() != nil {
+				return
+			}
+		}
+	}
+}
@@ -0,0 +1,64 @@
+package gometh
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/ethereum/go-ethereum/accounts/abi"
+	"github.com/ethereum/go-ethereum/common"
+)
+
+func TestTurn(t *testing.T) {
+
+	signers := []common.Address{
+		common.HexToAddress("0x1111111111111111111111111111111111111111"),
+		common.HexToAddress("0x2222222222222222222222222222222222222222"),
+		common.HexToAddress("0x3333333333333333333333333333333333333333"),
+	}
+	outsider := common.HexToAddress("0x4444444444444444444444444444444444444444")
+
+	for _, txid := range []common.Hash{{1}, {2}, {3}} {
+		// each signer has a different position, whatever the order of the
+		// signatures
+		positions := make(map[int]bool)
+		for _, signer := range signers {
+			reversed := []common.Address{signers[2], signers[1], signers[0]}
+			position := turn(txid, append([]common.Address(nil), signers...), signer)
+			if other := turn(txid, reversed, signer); other != position {
+				t.Errorf("txid %x: %v position depends on the signature order, %v and %v", txid[0], signer.Hex(), position, other)
+			}
+			positions[position] = true
+		}
+		if len(positions) != len(signers) {
+			t.Errorf("txid %x: positions %v are not a permutation", txid[0], positions)
+		}
+		if position := turn(txid, append([]common.Address(nil), signers...), outsider); position != len(signers) {
+			t.Errorf("txid %x: validator that did not sign has position %v", txid[0], position)
+		}
+	}
+}
+
+func TestIsRedeemedGetter(t *testing.T) {
+
+	const methods = `[
+		{"type":"function","name":"redeemed","constant":true,"inputs":[{"name":"txid","type":"bytes32"}],"outputs":[{"name":"","type":"bool"}]},
+		{"type":"function","name":"redeemedAt","constant":true,"inputs":[{"name":"txid","type":"bytes32"}],"outputs":[{"name":"","type":"uint256"}]},
+		{"type":"function","name":"redeemedBy","constant":true,"inputs":[{"name":"from","type":"address"}],"outputs":[{"name":"","type":"bool"}]}
+	]`
+	parsed, err := abi.JSON(strings.NewReader(methods))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	tests := map[string]bool{
+		"redeemed":   true,
+		"redeemedAt": false,
+		"redeemedBy": false,
+		"unknown":    false,
+	}
+	for name, getter := range tests {
+		if isRedeemedGetter(parsed.Methods[name]) != getter {
+			t.Errorf("%v is a redeemed getter: %v", name, !getter)
+		}
+	}
+}
@@ -1,40 +1,22 @@
 package gometh
 
 import (
+	"context"
+	"errors"
 	"log"
+	"net/http"
 	"time"
 
+	cfg "github.com/adriamb/gometh-server/gometh/config"
 	eth "github.com/adriamb/gometh-server/gometh/eth"
 
 	"github.com/ethereum/go-ethereum/core/types"
-	"github.com/ethereum/go-ethereum/crypto"
 )
 
-func sign(client *eth.Web3Client, data ...[]byte) ([3][32]byte, error) {
-	web3SignaturePrefix := []byte("\x19Ethereum Signed Message:\n32")
-
-	hash := crypto.Keccak256(data...)
-	prefixedHash := crypto.Keccak256(web3SignaturePrefix, hash)
-
-	var ret [3][32]byte
-
-	// The produced signature is in the [R || S || V] format where V is 0 or 1.
-	sig, err := client.Ks.SignHash(client.Account, prefixedHash)
-	if err != nil {
-		return ret, err
-	}
-
-	// We need to convert it to the format []uint256 = {v,r,s} format
-	ret[0][31] = sig[64] + 27
-	copy(ret[1][:], sig[0:32])
-	copy(ret[2][:], sig[32:64])
-	return ret, nil
-}
-
-func handleLogEvent(eventlog *types.Log) error {
+func handleLogEvent(ctx context.Context, eventlog *types.Log) error {
 
 	var event string
-	err := mainContract.Abi.Unpack(&event, "Log", eventlog.Data)
+	err := mainContract.DecodeEvent(&event, "Log", eventlog)
 	if err != nil {
 		return err
 	}
@@ -44,9 +26,10 @@ func handleLogEvent(eventlog *types.Log) error {
 	return nil
 }
 
-func serverStart() {
+func serverStart(ctx context.Context) {
 
-	// -- register event handlers & start processing
+	// -- register event handlers & start processing, the bridge contract
+	// goes first, the checkpoints are kept by its address
 
 	assert(mainClient.RegisterEventHandler(mainContract, "LogLock", handleLockEvent))
 	assert(mainClient.RegisterEventHandler(mainContract, "Log", handleLogEvent))
@@ -61,13 +44,53 @@ func serverStart() {
 	assert(sideClient.RegisterEventHandler(wethContract, "Transfer", handleTransferEvent))
 	assert(sideClient.RegisterEventHandler(wethContract, "Log", handleLogEvent))
 
-	cterminate := make(chan bool)
-	cterminated := make(chan bool)
-	pterminate := make(chan bool)
-	pterminated := make(chan bool)
+	if len(tokens) > 0 {
+		assert(mainClient.RegisterEventHandler(mainContract, "LogTokenLock", handleTokenLockEvent))
+		assert(sideClient.RegisterEventHandler(sideContract, "LogTokenBurn", handleTokenBurnEvent))
+		assert(sideClient.RegisterEventHandler(sideContract, "LogTokenBurnMultisigned", handleTokenBurnMultisignedEvent))
+	}
 
-	sideClient.HandleEvents(cterminate, cterminated)
-	mainClient.HandleEvents(pterminate, pterminated)
+	// -- middlewares & metrics
+
+	for _, client := range []*eth.Web3Client{mainClient, sideClient} {
+		client.Use(
+			eth.RecoverMiddleware,
+			eth.MetricsMiddleware(client.Name),
+			eth.TimingMiddleware(30*time.Second),
+		)
+		if cfg.Verbose > 0 {
+			client.Use(eth.LoggingMiddleware(client.Name))
+		}
+	}
+
+	if cfg.C.MetricsAddr != "" {
+		go func() {
+			// expvar publishes the metrics in /debug/vars
+			log.Println("Serving metrics at", cfg.C.MetricsAddr)
+			log.Println("[MetricsFailed]", http.ListenAndServe(cfg.C.MetricsAddr, nil))
+		}()
+	}
+
+	if relays != nil {
+		log.Println("Relaying the multisigned burns to the main chain")
+		go relays.run(ctx)
+	}
+
+	started := []chan bool{}
+	for _, client := range []*eth.Web3Client{sideClient, mainClient} {
+		terminated := make(chan bool)
+		err := client.HandleEvents(ctx, terminated)
+		// interrupted by a signal while processing the past events
+		if errors.Is(err, context.Canceled) {
+			break
+		}
+		assert(err)
+		started = append(started, terminated)
+	}
 
-	<-time.After(time.Second * 3600)
+	// runs until the context is cancelled by a signal
+	for _, terminated := range started {
+		<-terminated
+	}
+	log.Println("Server stopped")
 }
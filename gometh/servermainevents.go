@@ -1,15 +1,18 @@
 package gometh
 
 import (
+	"context"
+	"fmt"
 	"log"
 	"math/big"
 
+	eth "github.com/adriamb/gometh-server/gometh/eth"
+
 	"github.com/ethereum/go-ethereum/common"
 	"github.com/ethereum/go-ethereum/core/types"
-	"github.com/ethereum/go-ethereum/crypto"
 )
 
-func handleLockEvent(eventlog *types.Log) error {
+func handleLockEvent(ctx context.Context, eventlog *types.Log) error {
 
 	type LogLockEvent struct {
 		Epoch *big.Int
@@ -18,7 +21,7 @@ func handleLockEvent(eventlog *types.Log) error {
 	}
 
 	var event LogLockEvent
-	err := mainContract.Abi.Unpack(&event, "LogLock", eventlog.Data)
+	err := mainContract.DecodeEvent(&event, "LogLock", eventlog)
 	if err != nil {
 		return err
 	}
@@ -26,23 +29,48 @@ func handleLockEvent(eventlog *types.Log) error {
 	log.Printf("RECV LockEvent %v %v wei", event.From.Hex(), event.Value)
 	log.Printf("SEND partialExecuteOn _mintmultisigned")
 
-	mintmsg, err := sideContract.Abi.Pack("_mintmultisigned", event.From, event.Value)
+	_, err = sideContract.PartialExecuteOn(
+		ctx, eventlog, big.NewInt(0), 4000000,
+		"_mintmultisigned", event.From, event.Value,
+	)
+
+	if err == nil {
+		log.Printf("RCPT partialExecuteOn _mintmultisigned")
+	}
+	return err
+
+}
+
+func handleTokenLockEvent(ctx context.Context, eventlog *types.Log) error {
+
+	type LogTokenLockEvent struct {
+		Epoch *big.Int
+		Token common.Address
+		From  common.Address
+		Value *big.Int
+	}
+
+	var event LogTokenLockEvent
+	err := mainContract.DecodeEvent(&event, "LogTokenLock", eventlog)
 	if err != nil {
 		return err
 	}
 
-	txhash := crypto.Keccak256(eventlog.TxHash.Bytes(), eventlog.Topics[0].Bytes())
-	var txid [32]byte
-	copy(txid[:], txhash)
+	token := tokenByMain(event.Token)
+	if token == nil {
+		return eth.Permanent(fmt.Errorf("Token %v is not bridged", event.Token.Hex()))
+	}
+
+	log.Printf("RECV TokenLockEvent %v %v %v", event.From.Hex(), event.Value, token.Name)
+	log.Printf("SEND partialExecuteOn _minttokenmultisigned")
 
-	_, _, err = sideContract.SendTransactionSync(
-		big.NewInt(0), 4000000,
-		"partialExecuteOn", txid, mintmsg,
+	_, err = sideContract.PartialExecuteOn(
+		ctx, eventlog, big.NewInt(0), 4000000,
+		"_minttokenmultisigned", token.Wrapped.Address, event.From, event.Value,
 	)
 
 	if err == nil {
-		log.Printf("RCPT partialExecuteOn _mintmultisigned")
+		log.Printf("RCPT partialExecuteOn _minttokenmultisigned")
 	}
 	return err
-
 }
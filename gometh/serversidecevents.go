@@ -1,14 +1,19 @@
 package gometh
 
 import (
+	"context"
+	"fmt"
 	"log"
 	"math/big"
 
+	cfg "github.com/adriamb/gometh-server/gometh/config"
+	eth "github.com/adriamb/gometh-server/gometh/eth"
+
 	"github.com/ethereum/go-ethereum/common"
 	"github.com/ethereum/go-ethereum/core/types"
 )
 
-func handleBurnEvent(eventlog *types.Log) error {
+func handleBurnEvent(ctx context.Context, eventlog *types.Log) error {
 
 	type BurnEvent struct {
 		Epoch *big.Int
@@ -17,7 +22,7 @@ func handleBurnEvent(eventlog *types.Log) error {
 	}
 
 	var event BurnEvent
-	err := sideContract.Abi.Unpack(&event, "LogBurn", eventlog.Data)
+	err := sideContract.DecodeEvent(&event, "LogBurn", eventlog)
 	if err != nil {
 		return err
 	}
@@ -26,21 +31,92 @@ func handleBurnEvent(eventlog *types.Log) error {
 	log.Printf("SEND partialExecuteOff _burnmultisigned")
 
 	_, err = sideContract.PartialExecuteOff(
-		eventlog, big.NewInt(0), 4000000,
+		ctx, eventlog, big.NewInt(0), 4000000,
 		"_burnmultisigned", event.From, event.Value,
 	)
 
 	return err
 }
 
-func handleBurnMultisignedEvent(eventlog *types.Log) error {
+func handleBurnMultisignedEvent(ctx context.Context, eventlog *types.Log) error {
 
 	log.Printf("RECV LogBurnMultisigned")
 
-	return nil
+	if relays == nil {
+		return nil
+	}
+
+	type BurnMultisignedEvent struct {
+		Txid  [32]byte
+		From  common.Address
+		Value *big.Int
+	}
+
+	var event BurnMultisignedEvent
+	err := sideContract.DecodeEvent(&event, "LogBurnMultisigned", eventlog)
+	if err != nil {
+		return err
+	}
+
+	return relays.schedule(ctx, event.Txid, event.Value, ether(cfg.C.Relayer.MinValue))
+}
+
+func handleTokenBurnEvent(ctx context.Context, eventlog *types.Log) error {
+
+	type TokenBurnEvent struct {
+		Epoch *big.Int
+		Token common.Address
+		From  common.Address
+		Value *big.Int
+	}
+
+	var event TokenBurnEvent
+	err := sideContract.DecodeEvent(&event, "LogTokenBurn", eventlog)
+	if err != nil {
+		return err
+	}
+
+	token := tokenByWrapped(event.Token)
+	if token == nil {
+		return eth.Permanent(fmt.Errorf("Wrapped token %v is not bridged", event.Token.Hex()))
+	}
+
+	log.Printf("RECV LogTokenBurn %v %v %v", event.From.Hex(), event.Value, token.Name)
+	log.Printf("SEND partialExecuteOff _burntokenmultisigned")
+
+	_, err = sideContract.PartialExecuteOff(
+		ctx, eventlog, big.NewInt(0), 4000000,
+		"_burntokenmultisigned", token.Main, event.From, event.Value,
+	)
+
+	return err
+}
+
+func handleTokenBurnMultisignedEvent(ctx context.Context, eventlog *types.Log) error {
+
+	log.Printf("RECV LogTokenBurnMultisigned")
+
+	if relays == nil {
+		return nil
+	}
+
+	type TokenBurnMultisignedEvent struct {
+		Txid  [32]byte
+		Token common.Address
+		From  common.Address
+		Value *big.Int
+	}
+
+	var event TokenBurnMultisignedEvent
+	err := sideContract.DecodeEvent(&event, "LogTokenBurnMultisigned", eventlog)
+	if err != nil {
+		return err
+	}
+
+	return relays.schedule(ctx, event.Txid, event.Value, nil)
 }
 
-func handleStateChange(eventlog *types.Log) error {
+func handleStateChange(ctx context.Context, eventlog *types.Log) error {
 
 	log.Printf("RECV StateChangeEvent")
 
@@ -50,7 +126,7 @@ func handleStateChange(eventlog *types.Log) error {
 	}
 
 	var event StateChangeEvent
-	err := wethContract.Abi.Unpack(&event, "StateChange", eventlog.Data)
+	err := wethContract.DecodeEvent(&event, "StateChange", eventlog)
 	if err != nil {
 		return err
 	}
@@ -58,14 +134,14 @@ func handleStateChange(eventlog *types.Log) error {
 	log.Printf("SEND partialExecuteOff _statechangemultisigned")
 
 	_, err = sideContract.PartialExecuteOff(
-		eventlog, big.NewInt(0), 4000000,
+		ctx, eventlog, big.NewInt(0), 4000000,
 		"_statechangemultisigned", event.BlockNo, event.RootState,
 	)
 
 	return err
 }
 
-func handleStateChangeMultisigned(eventlog *types.Log) error {
+func handleStateChangeMultisigned(ctx context.Context, eventlog *types.Log) error {
 
 	type StateChangeMultisignedEvent struct {
 		TxID      [32]byte
@@ -78,7 +154,7 @@ func handleStateChangeMultisigned(eventlog *types.Log) error {
 	return nil
 }
 
-func handleMintMultisigned(eventlog *types.Log) error {
+func handleMintMultisigned(ctx context.Context, eventlog *types.Log) error {
 
 	type MintMultisignedEvent struct {
 		TxID  [32]byte
@@ -87,7 +163,7 @@ func handleMintMultisigned(eventlog *types.Log) error {
 	}
 
 	var event MintMultisignedEvent
-	err := sideContract.Abi.Unpack(&event, "LogMintMultisigned", eventlog.Data)
+	err := sideContract.DecodeEvent(&event, "LogMintMultisigned", eventlog)
 	if err != nil {
 		return err
 	}
@@ -97,22 +173,21 @@ func handleMintMultisigned(eventlog *types.Log) error {
 	return nil
 }
 
-func handleTransferEvent(eventlog *types.Log) error {
+func handleTransferEvent(ctx context.Context, eventlog *types.Log) error {
 
 	type TransferEvent struct {
+		From  common.Address
+		To    common.Address
 		Value *big.Int
 	}
 
 	var event TransferEvent
-	err := wethContract.Abi.Unpack(&event, "Transfer", eventlog.Data)
+	err := wethContract.DecodeEvent(&event, "Transfer", eventlog)
 	if err != nil {
 		return err
 	}
 
-	from := common.BytesToAddress(eventlog.Topics[1][:])
-	to := common.BytesToAddress(eventlog.Topics[2][:])
-
-	log.Printf("RECV Transfer %v %v->%v\n", event.Value, from.Hex(), to.Hex())
+	log.Printf("RECV Transfer %v %v->%v\n", event.Value, event.From.Hex(), event.To.Hex())
 
 	return nil
 }
@@ -0,0 +1,158 @@
+package store
+
+import (
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+)
+
+var (
+	// ErrNotFound when the key does not exist
+	ErrNotFound = fmt.Errorf("Key not found")
+	// ErrBadKey when the key cannot be used as a file name
+	ErrBadKey = fmt.Errorf("Bad key")
+)
+
+// Store is a small persistent key/value store where each value is kept
+// json-encoded in its own file, so several processes can share it
+type Store struct {
+	mutex *sync.Mutex
+	path  string
+}
+
+// Open opens (and creates, if needed) a store in the directory path
+func Open(path string) (*Store, error) {
+	if err := os.MkdirAll(path, 0700); err != nil {
+		return nil, err
+	}
+	return &Store{
+		mutex: &sync.Mutex{},
+		path:  path,
+	}, nil
+}
+
+// Bucket returns a store for the keys stored under name
+func (s *Store) Bucket(name string) (*Store, error) {
+	if err := checkKey(name); err != nil {
+		return nil, err
+	}
+	path := filepath.Join(s.path, name)
+	if err := os.MkdirAll(path, 0700); err != nil {
+		return nil, err
+	}
+	return &Store{
+		mutex: s.mutex,
+		path:  path,
+	}, nil
+}
+
+func checkKey(key string) error {
+	if key == "" || strings.ContainsAny(key, "/\\") || strings.HasPrefix(key, ".") {
+		return ErrBadKey
+	}
+	return nil
+}
+
+func (s *Store) file(key string) string {
+	return filepath.Join(s.path, key+".json")
+}
+
+// Put saves the value json-encoded, the write is atomic
+func (s *Store) Put(key string, value interface{}) error {
+	if err := checkKey(key); err != nil {
+		return err
+	}
+	content, err := json.MarshalIndent(value, "", "  ")
+	if err != nil {
+		return err
+	}
+
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	tmp, err := ioutil.TempFile(s.path, ".tmp-"+key)
+	if err != nil {
+		return err
+	}
+	if _, err = tmp.Write(content); err == nil {
+		err = tmp.Sync()
+	}
+	if closeErr := tmp.Close(); err == nil {
+		err = closeErr
+	}
+	if err != nil {
+		os.Remove(tmp.Name())
+		return err
+	}
+	return os.Rename(tmp.Name(), s.file(key))
+}
+
+// Get loads the value of key, returns ErrNotFound if it does not exist
+func (s *Store) Get(key string, value interface{}) error {
+	if err := checkKey(key); err != nil {
+		return err
+	}
+
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	content, err := ioutil.ReadFile(s.file(key))
+	if os.IsNotExist(err) {
+		return ErrNotFound
+	}
+	if err != nil {
+		return err
+	}
+	return json.Unmarshal(content, value)
+}
+
+// Has returns true if the key exists
+func (s *Store) Has(key string) (bool, error) {
+	if err := checkKey(key); err != nil {
+		return false, err
+	}
+	_, err := os.Stat(s.file(key))
+	if os.IsNotExist(err) {
+		return false, nil
+	}
+	return err == nil, err
+}
+
+// Delete removes the key, deleting an unexisting key is not an error
+func (s *Store) Delete(key string) error {
+	if err := checkKey(key); err != nil {
+		return err
+	}
+
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	err := os.Remove(s.file(key))
+	if os.IsNotExist(err) {
+		return nil
+	}
+	return err
+}
+
+// Keys returns the sorted list of keys in the store
+func (s *Store) Keys() ([]string, error) {
+	files, err := ioutil.ReadDir(s.path)
+	if err != nil {
+		return nil, err
+	}
+	keys := []string{}
+	for _, f := range files {
+		name := f.Name()
+		if f.IsDir() || strings.HasPrefix(name, ".") || !strings.HasSuffix(name, ".json") {
+			continue
+		}
+		keys = append(keys, strings.TrimSuffix(name, ".json"))
+	}
+	sort.Strings(keys)
+	return keys, nil
+}
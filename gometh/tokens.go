@@ -0,0 +1,87 @@
+package gometh
+
+import (
+	"context"
+	"fmt"
+	"log"
+
+	cfg "github.com/adriamb/gometh-server/gometh/config"
+	eth "github.com/adriamb/gometh-server/gometh/eth"
+
+	"github.com/ethereum/go-ethereum/common"
+)
+
+// bridgedToken is an ERC20 token of the main chain and its wrapped token in
+// the side chain, minted and burnt by the side contract
+type bridgedToken struct {
+	Name    string
+	Main    common.Address
+	Wrapped *eth.Contract
+}
+
+// tokens is the registry of the bridged tokens
+var tokens []*bridgedToken
+
+// loadTokens creates the registry from the configuration
+func loadTokens() {
+
+	assert(cfg.C.VerifyTokens())
+
+	tokens = nil
+	for _, c := range cfg.C.Tokens {
+		wrapped, err := eth.NewContract(sideClient, cfg.C.Contracts.Path+"/WrappedToken.json")
+		assert(err)
+		tokens = append(tokens, &bridgedToken{
+			Name:    c.Name,
+			Main:    common.HexToAddress(c.MainAddress),
+			Wrapped: wrapped,
+		})
+	}
+}
+
+// deployTokens deploys the wrapped tokens without SideAddress
+func deployTokens(ctx context.Context) {
+
+	for i, token := range tokens {
+		if cfg.C.Tokens[i].SideAddress != "" {
+			continue
+		}
+		_, _, err := token.Wrapped.Deploy(ctx, sideContract.Address, token.Main)
+		assert(err)
+		log.Printf("WrappedToken %v of %v deployed at %v, set it as its SideAddress", token.Name, token.Main.Hex(), token.Wrapped.Address.Hex())
+	}
+}
+
+// setTokensAddress sets the address of the wrapped tokens
+func setTokensAddress(ctx context.Context) {
+
+	for i, token := range tokens {
+		if cfg.C.Tokens[i].SideAddress == "" {
+			assert(fmt.Errorf("Token %v has no SideAddress, deploy it first", token.Name))
+		}
+		assert(token.Wrapped.SetAddress(ctx, common.HexToAddress(cfg.C.Tokens[i].SideAddress)))
+		log.Printf("WrappedToken %v address is %v", token.Name, token.Wrapped.Address.Hex())
+	}
+}
+
+// tokenByMain returns the bridged token of the main chain address, nil if
+// it is not bridged
+func tokenByMain(address common.Address) *bridgedToken {
+	for _, token := range tokens {
+		if token.Main == address {
+			return token
+		}
+	}
+	return nil
+}
+
+// tokenByWrapped returns the bridged token of the wrapped token address,
+// nil if it is not bridged
+func tokenByWrapped(address common.Address) *bridgedToken {
+	for _, token := range tokens {
+		if token.Wrapped.Address != nil && *token.Wrapped.Address == address {
+			return token
+		}
+	}
+	return nil
+}
@@ -0,0 +1,49 @@
+package gometh
+
+import (
+	"context"
+	"fmt"
+
+	eth "github.com/adriamb/gometh-server/gometh/eth"
+	"github.com/ethereum/go-ethereum"
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/core/types"
+)
+
+// replaceTransaction speeds up, or cancels, a pending transaction of the
+// account, looking for it in both chains. The replacement is recorded in
+// the journal entry of its nonce, so the server tracks it when resumed.
+func replaceTransaction(ctx context.Context, hash string, cancel bool) error {
+
+	if len(common.FromHex(hash)) != common.HashLength {
+		return fmt.Errorf("Bad transaction hash %v", hash)
+	}
+	txhash := common.HexToHash(hash)
+
+	journal := openJournal()
+
+	for _, client := range []*eth.Web3Client{mainClient, sideClient} {
+
+		client.Journal = journal
+
+		var tx *types.Transaction
+		var err error
+
+		if cancel {
+			tx, err = client.Cancel(ctx, txhash)
+		} else {
+			tx, err = client.SpeedUp(ctx, txhash)
+		}
+		if err == ethereum.NotFound {
+			continue
+		}
+		if err != nil {
+			return fmt.Errorf("Cannot replace %v in %v chain: %v", hash, client.Name, err)
+		}
+
+		fmt.Printf("Transaction %v replaced by %v in %v chain\n", hash, tx.Hash().Hex(), client.Name)
+		return nil
+	}
+
+	return fmt.Errorf("Transaction %v not found", hash)
+}
@@ -0,0 +1,281 @@
+package gometh
+
+import (
+	"context"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"math/big"
+	"os"
+
+	cfg "github.com/adriamb/gometh-server/gometh/config"
+	eth "github.com/adriamb/gometh-server/gometh/eth"
+
+	"github.com/ethereum/go-ethereum/accounts"
+	"github.com/ethereum/go-ethereum/accounts/abi"
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/common/hexutil"
+	"github.com/ethereum/go-ethereum/common/math"
+	"github.com/ethereum/go-ethereum/crypto"
+)
+
+// voucherVersion is the version of the voucher file format, version 1
+// vouchers have no Token and are read as ether vouchers
+const voucherVersion = 2
+
+// Voucher is the proof, signed by the validators, that a burn of the side
+// chain can be released in the main chain. Only TxID, Epoch and Data are
+// signed, the other fields describe them.
+type Voucher struct {
+	Version int
+
+	TxID common.Hash
+	// Token is the ERC20 token of the main chain, zero for ether
+	Token     common.Address
+	Recipient common.Address
+	Value     *hexutil.Big
+	Epoch     *hexutil.Big
+	// Data is the multisigned call, Sigs the {v,r,s} of each signer
+	Data hexutil.Bytes
+	Sigs []common.Hash
+
+	MainChainID  *hexutil.Big
+	SideChainID  *hexutil.Big
+	MainContract common.Address
+	SideContract common.Address
+}
+
+// decodeBurnData returns the token, zero for ether, recipient and value of
+// the data of a burn, a _burnmultisigned or _burntokenmultisigned call of
+// the side contract
+func decodeBurnData(sideAbi abi.ABI, data []byte) (common.Address, common.Address, *big.Int, error) {
+
+	var token common.Address
+
+	if len(data) < 4 {
+		return token, common.Address{}, nil, fmt.Errorf("Data is not a burn call")
+	}
+	method, err := sideAbi.MethodById(data[:4])
+	if err != nil || (method.Name != "_burnmultisigned" && method.Name != "_burntokenmultisigned") {
+		return token, common.Address{}, nil, fmt.Errorf("Data is not a burn call")
+	}
+	args, err := method.Inputs.Unpack(data[4:])
+	if err != nil {
+		return token, common.Address{}, nil, err
+	}
+	if method.Name == "_burntokenmultisigned" && len(args) == 3 {
+		token, _ = args[0].(common.Address)
+		args = args[1:]
+	}
+	if len(args) != 2 {
+		return token, common.Address{}, nil, fmt.Errorf("Unexpected %v arguments", method.Name)
+	}
+	recipient, ok1 := args[0].(common.Address)
+	value, ok2 := args[1].(*big.Int)
+	if !ok1 || !ok2 {
+		return token, common.Address{}, nil, fmt.Errorf("Unexpected %v arguments", method.Name)
+	}
+	return token, recipient, value, nil
+}
+
+// fetchVoucher reads the signatures of the burn txid from the side chain
+func fetchVoucher(ctx context.Context, txid [32]byte) (*Voucher, error) {
+
+	type GetSignatures struct {
+		Epoch *big.Int
+		Data  []byte
+		Sigs  [][32]byte
+	}
+
+	var output GetSignatures
+	if err := sideContract.Call(ctx, &output, "getSignatures", txid); err != nil {
+		return nil, err
+	}
+	if len(output.Sigs) == 0 {
+		return nil, fmt.Errorf("No signatures for burn %v", hex.EncodeToString(txid[:]))
+	}
+
+	token, recipient, value, err := decodeBurnData(sideContract.Abi, output.Data)
+	if err != nil {
+		return nil, fmt.Errorf("Cannot decode data of burn %v: %v", hex.EncodeToString(txid[:]), err)
+	}
+
+	mainChainID, err := mainClient.ChainID(ctx)
+	if err != nil {
+		return nil, err
+	}
+	sideChainID, err := sideClient.ChainID(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	voucher := &Voucher{
+		Version:      voucherVersion,
+		TxID:         txid,
+		Token:        token,
+		Recipient:    recipient,
+		Value:        (*hexutil.Big)(value),
+		Epoch:        (*hexutil.Big)(output.Epoch),
+		Data:         output.Data,
+		MainChainID:  (*hexutil.Big)(mainChainID),
+		SideChainID:  (*hexutil.Big)(sideChainID),
+		MainContract: *mainContract.Address,
+		SideContract: *sideContract.Address,
+	}
+	for _, sig := range output.Sigs {
+		voucher.Sigs = append(voucher.Sigs, sig)
+	}
+
+	return voucher, nil
+}
+
+// readVoucher reads a voucher json file
+func readVoucher(path string) (*Voucher, error) {
+
+	content, err := ioutil.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	var voucher Voucher
+	if err := json.Unmarshal(content, &voucher); err != nil {
+		return nil, fmt.Errorf("Bad voucher file %v: %v", path, err)
+	}
+	switch voucher.Version {
+	case 1:
+		voucher.Token = common.Address{}
+	case voucherVersion:
+	default:
+		return nil, fmt.Errorf("Unsupported voucher version %v in %v", voucher.Version, path)
+	}
+	if voucher.Epoch == nil || voucher.Value == nil {
+		return nil, fmt.Errorf("Bad voucher file %v: missing Epoch or Value", path)
+	}
+	return &voucher, nil
+}
+
+// writeVoucher writes the voucher json to the file, or to stdout if path
+// is empty or -
+func writeVoucher(voucher *Voucher, path string) error {
+
+	content, err := json.MarshalIndent(voucher, "", "  ")
+	if err != nil {
+		return err
+	}
+	content = append(content, '\n')
+
+	if path == "" || path == "-" {
+		_, err = os.Stdout.Write(content)
+		return err
+	}
+	return ioutil.WriteFile(path, content, 0644)
+}
+
+// unit is the unit of the value, wei or the token
+func (v *Voucher) unit() string {
+	if v.Token == (common.Address{}) {
+		return "wei"
+	}
+	return "of token " + v.Token.Hex()
+}
+
+func (v *Voucher) sigs() [][32]byte {
+	sigs := make([][32]byte, len(v.Sigs))
+	for i, sig := range v.Sigs {
+		sigs[i] = sig
+	}
+	return sigs
+}
+
+// Signers recovers the address of each signature, the signed hash is the
+// one of PartialExecuteOff, keccak(epoch, txid, data)
+func (v *Voucher) Signers() ([]common.Address, error) {
+
+	if v.Epoch == nil || len(v.Sigs)%3 != 0 {
+		return nil, fmt.Errorf("Bad voucher, %v signature words", len(v.Sigs))
+	}
+
+	epoch := math.U256Bytes(new(big.Int).Set(v.Epoch.ToInt()))
+	hash := accounts.TextHash(crypto.Keccak256(epoch, v.TxID[:], v.Data))
+
+	signers := []common.Address{}
+	for i := 0; i < len(v.Sigs); i += 3 {
+		sigv, r, s := v.Sigs[i], v.Sigs[i+1], v.Sigs[i+2]
+
+		sig := make([]byte, 65)
+		copy(sig[0:32], r[:])
+		copy(sig[32:64], s[:])
+		sig[64] = sigv[31] - 27
+
+		pubkey, err := crypto.SigToPub(hash, sig)
+		if err != nil {
+			return nil, fmt.Errorf("Bad signature #%v: %v", i/3, err)
+		}
+		signers = append(signers, crypto.PubkeyToAddress(*pubkey))
+	}
+	return signers, nil
+}
+
+// verifyVoucher checks offline that the voucher is signed by the configured
+// signers, and that its recipient and value are the ones signed
+func verifyVoucher(path string) error {
+
+	voucher, err := readVoucher(path)
+	if err != nil {
+		return err
+	}
+	if err := cfg.C.VerifyDeploySigners(); err != nil {
+		return err
+	}
+
+	known := make(map[common.Address]bool)
+	for _, signer := range cfg.C.Contracts.DeploySigners {
+		known[common.HexToAddress(signer)] = true
+	}
+
+	side, err := eth.NewContract(nil, cfg.C.Contracts.Path+"/GomethSide.json")
+	if err != nil {
+		return err
+	}
+	token, recipient, value, err := decodeBurnData(side.Abi, voucher.Data)
+	if err != nil {
+		return err
+	}
+	if token != voucher.Token || recipient != voucher.Recipient || value.Cmp(voucher.Value.ToInt()) != 0 {
+		return fmt.Errorf("Voucher token, recipient and value do not match the signed data, signed %v of %v to %v", value, token.Hex(), recipient.Hex())
+	}
+
+	signers, err := voucher.Signers()
+	if err != nil {
+		return err
+	}
+	if len(signers) == 0 {
+		return fmt.Errorf("Voucher has no signatures")
+	}
+
+	fmt.Println("Voucher", voucher.TxID.Hex())
+	fmt.Println("  recipient :", voucher.Recipient.Hex())
+	fmt.Println("  value     :", voucher.Value.ToInt(), voucher.unit())
+
+	seen := make(map[common.Address]bool)
+	for i, signer := range signers {
+		status := "ok"
+		switch {
+		case seen[signer]:
+			status = "duplicated"
+		case !known[signer]:
+			status = "unknown signer"
+		}
+		seen[signer] = true
+		fmt.Printf("  sig #%v   : %v %v\n", i, signer.Hex(), status)
+		if status != "ok" {
+			err = fmt.Errorf("Voucher has invalid signatures")
+		}
+	}
+	if err != nil {
+		return err
+	}
+
+	fmt.Printf("Voucher signed by %v of %v signers\n", len(signers), len(known))
+	return nil
+}
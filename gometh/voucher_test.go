@@ -0,0 +1,108 @@
+package gometh
+
+import (
+	"encoding/json"
+	"io/ioutil"
+	"math/big"
+	"path/filepath"
+	"testing"
+
+	"github.com/ethereum/go-ethereum/accounts"
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/common/hexutil"
+	"github.com/ethereum/go-ethereum/common/math"
+	"github.com/ethereum/go-ethereum/crypto"
+)
+
+// signVoucher adds the {v,r,s} of key as PartialExecuteOff signs them
+func signVoucher(t *testing.T, voucher *Voucher, hexkey string) common.Address {
+	key, err := crypto.HexToECDSA(hexkey)
+	if err != nil {
+		t.Fatal(err)
+	}
+	epoch := math.U256Bytes(new(big.Int).Set(voucher.Epoch.ToInt()))
+	hash := accounts.TextHash(crypto.Keccak256(epoch, voucher.TxID[:], voucher.Data))
+	sig, err := crypto.Sign(hash, key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var v common.Hash
+	v[31] = sig[64] + 27
+	voucher.Sigs = append(voucher.Sigs, v, common.BytesToHash(sig[0:32]), common.BytesToHash(sig[32:64]))
+	return crypto.PubkeyToAddress(key.PublicKey)
+}
+
+func TestVoucherSigners(t *testing.T) {
+
+	voucher := &Voucher{
+		Version: voucherVersion,
+		TxID:    common.Hash{1},
+		Epoch:   (*hexutil.Big)(big.NewInt(0)),
+		Data:    []byte{1, 2, 3},
+	}
+	first := signVoucher(t, voucher, "b71c71a67e1177ad4e901695e1b4b9ee17ae16c6668d313eac2f96dbcda3f291")
+	second := signVoucher(t, voucher, "8a1f9a8f95be41cd7ccb6168179afb4504aefe388d1e14474d32c45c72ce7b7a")
+
+	signers, err := voucher.Signers()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(signers) != 2 || signers[0] != first || signers[1] != second {
+		t.Errorf("signers %v, expected %v and %v", signers, first.Hex(), second.Hex())
+	}
+
+	// the signatures are not valid for other data
+	voucher.Data = []byte{1, 2, 4}
+	if signers, err := voucher.Signers(); err == nil && (signers[0] == first || signers[1] == second) {
+		t.Errorf("signers %v recovered from tampered data", signers)
+	}
+
+	voucher.Sigs = voucher.Sigs[:4]
+	if _, err := voucher.Signers(); err == nil {
+		t.Errorf("accepted incomplete signatures")
+	}
+}
+
+func TestReadVoucherVersion(t *testing.T) {
+
+	dir := t.TempDir()
+	token := common.HexToAddress("0x1111111111111111111111111111111111111111")
+
+	write := func(version int) string {
+		voucher := &Voucher{
+			Version: version,
+			Token:   token,
+			Value:   (*hexutil.Big)(big.NewInt(1)),
+			Epoch:   (*hexutil.Big)(big.NewInt(0)),
+		}
+		content, err := json.Marshal(voucher)
+		if err != nil {
+			t.Fatal(err)
+		}
+		path := filepath.Join(dir, "voucher.json")
+		if err := ioutil.WriteFile(path, content, 0644); err != nil {
+			t.Fatal(err)
+		}
+		return path
+	}
+
+	voucher, err := readVoucher(write(1))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if voucher.Token != (common.Address{}) {
+		t.Errorf("version 1 voucher read with token %v", voucher.Token.Hex())
+	}
+
+	voucher, err = readVoucher(write(voucherVersion))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if voucher.Token != token {
+		t.Errorf("voucher read with token %v, expected %v", voucher.Token.Hex(), token.Hex())
+	}
+
+	if _, err := readVoucher(write(voucherVersion + 1)); err == nil {
+		t.Errorf("accepted unknown voucher version")
+	}
+}
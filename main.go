@@ -1,12 +1,24 @@
 package main
 
 import (
-	gometh "github.com/adriamb/gometh-server/gometh"
+	"fmt"
+	"os"
 
-	"github.com/CrowdSurge/banner"
+	gometh "github.com/adriamb/gometh-server/gometh"
 )
 
+// banner is printed at startup, to stderr so it does not mix with the output
+// of the commands. It was printed with github.com/CrowdSurge/banner, that
+// is no longer available as a go module.
+const banner = `                            _   _
+  __ _  ___  _ __ ___   ___| |_| |__
+ / _` + "`" + ` |/ _ \| '_ ` + "`" + ` _ \ / _ \ __| '_ \
+| (_| | (_) | | | | | |  __/ |_| | | |
+ \__, |\___/|_| |_| |_|\___|\__|_| |_|
+ |___/
+`
+
 func main() {
-	banner.Print("gometh")
+	fmt.Fprint(os.Stderr, banner)
 	gometh.ExecuteCmd()
 }
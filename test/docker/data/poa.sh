@@ -9,6 +9,8 @@ hwclock -s
 rm -rf /dyndata
 mkdir /dyndata
 cp -R /data/$1/* /dyndata
+# gometh only reads password files private to their owner
+chmod 600 /dyndata/password
 /geth init /data/gomet-genesis.json
 acc=$(cat  $CFG/account)
 
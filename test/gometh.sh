@@ -1 +1,3 @@
+# the keystore password is read from GOMETH_PASSWD, 111111 for test/keystore
+export GOMETH_PASSWD=${GOMETH_PASSWD:-111111}
 go run main.go --config test/gometh.yaml $*